@@ -0,0 +1,44 @@
+package gocache
+
+import "sync/atomic"
+
+// WithAccessCounts counts the Get hits of every key, for AccessCount.
+// Counts are kept while the key is in the cache, across overwrites, and are bumped atomically
+// under the read lock, so they only cost an atomic add per hit.
+func WithAccessCounts() Option {
+	return func(c *Cache) {
+		c.accesses = map[string]*uint64{}
+	}
+}
+
+// AccessCount returns how many times Get found the key k since it was added,
+// and false if the key isn't live or WithAccessCounts isn't enabled.
+func (c *Cache) AccessCount(k string) (uint64, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	n, found := c.accesses[k]
+	if !found {
+		return 0, false
+	}
+	if item, found := c.items[k]; !found || c.expired(item) {
+		return 0, false
+	}
+	return atomic.LoadUint64(n), true
+}
+
+// track starts counting the accesses to the key k, if enabled and not done yet.
+func (c *Cache) track(k string) {
+	if c.accesses == nil {
+		return
+	}
+	if _, found := c.accesses[k]; !found {
+		c.accesses[k] = new(uint64)
+	}
+}
+
+// accessed counts a Get hit of the key k, it only needs the read lock.
+func (c *Cache) accessed(k string) {
+	if n, found := c.accesses[k]; found {
+		atomic.AddUint64(n, 1)
+	}
+}
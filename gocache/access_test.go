@@ -0,0 +1,51 @@
+package gocache
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAccessCount(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Get("a")
+	if _, ok := tc.AccessCount("a"); ok {
+		t.Error("Expected no access counts unless enabled")
+	}
+
+	tc = NewCache(DefaultExpiration, time.Hour, WithAccessCounts())
+	defer tc.StopGc()
+	tc.Set("a", 1, DefaultExpiration)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tc.Get("a")
+			tc.Get("missing")
+		}()
+	}
+	wg.Wait()
+	if n, ok := tc.AccessCount("a"); !ok || n != 10 {
+		t.Error("Expected 10 accesses, got", n, ok)
+	}
+	tc.Set("a", 2, DefaultExpiration)
+	if n, _ := tc.AccessCount("a"); n != 10 {
+		t.Error("Expected overwrites to keep the count, got", n)
+	}
+	if _, ok := tc.AccessCount("missing"); ok {
+		t.Error("Expected no count for a missing key")
+	}
+	tc.Delete("a")
+	tc.Set("a", 3, DefaultExpiration)
+	if n, ok := tc.AccessCount("a"); !ok || n != 0 {
+		t.Error("Expected a deleted key to start over, got", n, ok)
+	}
+	tc.ReplaceAll(map[string]interface{}{"b": 1}, DefaultExpiration)
+	tc.Get("b")
+	if n, ok := tc.AccessCount("b"); !ok || n != 1 {
+		t.Error("Expected items set by ReplaceAll to be counted, got", n, ok)
+	}
+}
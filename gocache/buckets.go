@@ -0,0 +1,133 @@
+package gocache
+
+import (
+	"sort"
+	"time"
+)
+
+// WithExpirationBuckets indexes the items by expiration time in buckets of the given width,
+// a simple timing wheel, so DeleteExpired only visits the buckets that are due
+// instead of scanning every item. GC cost then grows with the number of expiring items, not the cache size,
+// at the price of maintaining the index on every write.
+func WithExpirationBuckets(width time.Duration) Option {
+	return func(c *Cache) {
+		if width > 0 {
+			c.bucketWidth = int64(width)
+		}
+	}
+}
+
+// bucket adds k to the expiration index.
+func (c *Cache) bucket(k string, expiration int64) {
+	if c.bucketWidth <= 0 || expiration <= 0 {
+		return
+	}
+	b := expiration / c.bucketWidth
+	if c.buckets == nil {
+		c.buckets = map[int64]map[string]struct{}{}
+	}
+	keys, found := c.buckets[b]
+	if !found {
+		keys = map[string]struct{}{}
+		c.buckets[b] = keys
+	}
+	keys[k] = struct{}{}
+}
+
+// unbucket removes k from the expiration index.
+func (c *Cache) unbucket(k string, expiration int64) {
+	if c.bucketWidth <= 0 || expiration <= 0 {
+		return
+	}
+	b := expiration / c.bucketWidth
+	if keys, found := c.buckets[b]; found {
+		delete(keys, k)
+		if len(keys) == 0 {
+			delete(c.buckets, b)
+		}
+	}
+}
+
+// gcBudgetCheckInterval is the number of items visited by forEachExpired between checks of its deadline.
+const gcBudgetCheckInterval = 256
+
+// forEachExpired calls f for every item expired at now, it may delete the item.
+// Unless deadline is zero, it stops early once it's past deadline and then returns false.
+func (c *Cache) forEachExpired(now int64, deadline time.Time, f func(string, Item)) bool {
+	visited := 0
+	late := func() bool {
+		visited++
+		return !deadline.IsZero() && visited%gcBudgetCheckInterval == 0 && time.Now().After(deadline)
+	}
+	if c.bucketWidth <= 0 {
+		for k, v := range c.items {
+			if late() {
+				return false
+			}
+			if v.Expiration > 0 && now > v.Expiration {
+				f(k, v)
+			}
+		}
+		return true
+	}
+	due := now / c.bucketWidth
+	for b, keys := range c.buckets {
+		if b > due {
+			continue
+		}
+		for k := range keys {
+			if late() {
+				return false
+			}
+			// Buckets before the current one are entirely expired
+			if v := c.items[k]; b < due || now > v.Expiration {
+				f(k, v)
+			}
+		}
+	}
+	return true
+}
+
+// nearestExpiry returns the key of the live item expiring first at now, using the buckets if enabled.
+func (c *Cache) nearestExpiry(now int64) (string, bool) {
+	if c.bucketWidth <= 0 {
+		return nearestIn(c.items, now, nil)
+	}
+	due := now / c.bucketWidth
+	bs := make([]int64, 0, len(c.buckets))
+	for b := range c.buckets {
+		if b >= due {
+			bs = append(bs, b)
+		}
+	}
+	sort.Slice(bs, func(i, j int) bool { return bs[i] < bs[j] })
+	for _, b := range bs {
+		if k, found := nearestIn(c.items, now, c.buckets[b]); found {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// nearestIn returns the key of the live item expiring first among keys, or among all items if keys is nil.
+func nearestIn(items map[string]Item, now int64, keys map[string]struct{}) (string, bool) {
+	var (
+		nearest string
+		min     int64
+	)
+	visit := func(k string, v Item) {
+		if v.Expiration > 0 && now <= v.Expiration && (min == 0 || v.Expiration < min) {
+			nearest, min = k, v.Expiration
+		}
+	}
+	if keys == nil {
+		for k, v := range items {
+			visit(k, v)
+		}
+	} else {
+		for k := range keys {
+			visit(k, items[k])
+		}
+	}
+	return nearest, min != 0
+}
@@ -0,0 +1,51 @@
+package gocache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestExpirationBuckets(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour, WithExpirationBuckets(time.Minute))
+	defer tc.StopGc()
+	for i := 0; i < 100; i++ {
+		tc.Set(strconv.Itoa(i), i, time.Millisecond)
+	}
+	tc.Set("later", 0, time.Hour)
+	tc.Set("never", 0, NoExpiration)
+	tc.Set("reset", 0, time.Millisecond)
+	tc.Set("reset", 0, time.Hour)
+	<-time.After(5 * time.Millisecond)
+	tc.DeleteExpired()
+	if n := tc.Count(); n != 3 {
+		t.Error("Expected 3 items to remain, got", n)
+	}
+	if n := len(tc.buckets); n != 1 {
+		t.Error("Expected only the bucket of later and reset to remain, got", n)
+	}
+	tc.Delete("later")
+	tc.Delete("reset")
+	if n := len(tc.buckets); n != 0 {
+		t.Error("Deleting items didn't clean up the buckets:", tc.buckets)
+	}
+}
+
+func BenchmarkDeleteExpiredScan(b *testing.B) {
+	benchmarkDeleteExpired(b, NewCache(DefaultExpiration, time.Hour))
+}
+
+func BenchmarkDeleteExpiredBuckets(b *testing.B) {
+	benchmarkDeleteExpired(b, NewCache(DefaultExpiration, time.Hour, WithExpirationBuckets(time.Second)))
+}
+
+func benchmarkDeleteExpired(b *testing.B, tc *Cache) {
+	defer tc.StopGc()
+	for i := 0; i < 100000; i++ {
+		tc.Set(strconv.Itoa(i), i, time.Hour)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tc.DeleteExpired()
+	}
+}
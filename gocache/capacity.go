@@ -0,0 +1,127 @@
+package gocache
+
+import "time"
+
+// defaultEvictionSampleSize is the number of items sampled to pick an eviction victim, as in Redis.
+const defaultEvictionSampleSize = 5
+
+// EvictionPolicy decides which item is evicted when the cache is full.
+type EvictionPolicy int
+
+const (
+	// EvictSoonestExpiry evicts the sampled item closest to expiring, it's the default.
+	EvictSoonestExpiry EvictionPolicy = iota
+	// EvictLFU evicts the sampled item accessed least frequently, as estimated by a count-min sketch
+	// (TinyLFU style) fed by Get hits and writes. The sketch uses bounded memory and ages its counters
+	// so past popularity fades. It improves hit ratios on skewed access patterns.
+	EvictLFU
+)
+
+// WithEvictionPolicy sets the policy picking eviction victims once the cache is full, see WithMaxItems.
+func WithEvictionPolicy(p EvictionPolicy) Option {
+	return func(c *Cache) {
+		c.evictionPolicy = p
+	}
+}
+
+// WithMaxItems limits the cache to n items. Once it's full, every write path adding a new key
+// (Set, Add, Replace, Load and the like) first evicts an item picked among a random sample,
+// see WithEvictionSampleSize, by the eviction policy. With the default policy the item closest to expiring
+// is evicted, so expired items tend to go first and items that never expire last.
+func WithMaxItems(n int) Option {
+	return func(c *Cache) {
+		c.maxItems = n
+	}
+}
+
+// WithCountExpiredTowardCapacity sets whether expired items not collected by the GC yet take up capacity,
+// which they do by default: a write to a full cache then evicts a victim picked by the eviction policy,
+// which may be a live item even though expired ones are sampled first. With false, a write adding a key
+// to a full cache first deletes every expired item, as the GC would, and only evicts live items
+// if the cache is still full. This costs a scan of the items, or of the due buckets with WithExpirationBuckets.
+func WithCountExpiredTowardCapacity(count bool) Option {
+	return func(c *Cache) {
+		c.reclaimExpired = !count
+	}
+}
+
+// WithEvictionSampleSize sets how many random items are sampled to pick an eviction victim, 5 by default.
+// A larger k picks a better victim at a higher CPU cost per eviction. It panics if k is less than 1.
+func WithEvictionSampleSize(k int) Option {
+	if k < 1 {
+		panic("gocache: eviction sample size must be at least 1")
+	}
+	return func(c *Cache) {
+		c.evictionSampleSize = k
+	}
+}
+
+// makeRoom evicts items until a new key k fits within the capacity.
+func (c *Cache) makeRoom(k string) {
+	if c.maxItems <= 0 {
+		return
+	}
+	if _, found := c.items[k]; found {
+		return
+	}
+	if len(c.items) >= c.maxItems && c.reclaimExpired {
+		c.deleteExpired(time.Time{})
+	}
+	for len(c.items) >= c.maxItems {
+		c.del(c.victim(nil), EvictCapacity)
+	}
+}
+
+// victim returns the key of the item to evict according to the eviction policy, skipping the keys in keep.
+func (c *Cache) victim(keep map[string]*txWrite) string {
+	if c.sketch != nil {
+		return c.lfuVictim(keep)
+	}
+	return c.expiryVictim(keep)
+}
+
+// lfuVictim returns the key of the least frequently accessed item among a random sample.
+func (c *Cache) lfuVictim(keep map[string]*txWrite) string {
+	var victim string
+	min := -1
+	n := 0
+	for k := range c.items {
+		if n == c.evictionSampleSize {
+			break
+		}
+		if _, found := keep[k]; found {
+			continue
+		}
+		n++
+		if f := int(c.sketch.estimate(k)); min < 0 || f < min {
+			victim, min = k, f
+		}
+	}
+	return victim
+}
+
+// expiryVictim returns the key of the item closest to expiring among a random sample.
+func (c *Cache) expiryVictim(keep map[string]*txWrite) string {
+	var victim string
+	var min int64
+	n := 0
+	for k, v := range c.items {
+		if n == c.evictionSampleSize {
+			break
+		}
+		if _, found := keep[k]; found {
+			continue
+		}
+		n++
+		if v.Expiration == 0 {
+			if min == 0 && victim == "" {
+				victim = k
+			}
+			continue
+		}
+		if min == 0 || v.Expiration < min {
+			victim, min = k, v.Expiration
+		}
+	}
+	return victim
+}
@@ -0,0 +1,157 @@
+package gocache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMaxItems(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour, WithMaxItems(2))
+	defer tc.StopGc()
+	var evicted []string
+	tc.OnEvicted(func(k string, v interface{}) {
+		evicted = append(evicted, k)
+	})
+	tc.Set("a", 1, NoExpiration)
+	tc.Set("b", 2, time.Minute)
+	if err := tc.Add("c", 3, time.Hour); err != nil {
+		t.Fatal("Add at capacity failed:", err)
+	}
+	if tc.Count() != 2 {
+		t.Error("Add grew the cache beyond its capacity:", tc.Count())
+	}
+	if _, found := tc.Get("b"); found {
+		t.Error("Expected b, the item closest to expiring, to be evicted")
+	}
+	if err := tc.Replace("c", 4, time.Hour); err != nil {
+		t.Fatal("Replace at capacity failed:", err)
+	}
+	if tc.Count() != 2 {
+		t.Error("Replacing an existing key evicted an item")
+	}
+	tc.Set("d", 5, NoExpiration)
+	if _, found := tc.Get("c"); found {
+		t.Error("Expected c to be evicted before the items that never expire")
+	}
+	if len(evicted) != 2 || evicted[0] != "b" || evicted[1] != "c" {
+		t.Error("Unexpected evictions:", evicted)
+	}
+}
+
+func TestReplaceAllMaxItems(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour, WithMaxItems(2))
+	defer tc.StopGc()
+	tc.ReplaceAll(map[string]interface{}{"d": 4, "c": 3, "b": 2, "a": 1}, DefaultExpiration)
+	if n := tc.Count(); n != 2 {
+		t.Error("Expected ReplaceAll to respect the capacity, got", n)
+	}
+	if _, found := tc.Get("a"); !found {
+		t.Error("Expected the first keys to be kept")
+	}
+}
+
+func TestEvictionSampleSize(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour, WithMaxItems(100), WithEvictionSampleSize(1000))
+	defer tc.StopGc()
+	for i := 0; i < 100; i++ {
+		tc.Set(strconv.Itoa(i), i, time.Duration(i+1)*time.Minute)
+	}
+	tc.Set("new", 0, NoExpiration)
+	if _, found := tc.Get("0"); found {
+		t.Error("Expected a full sample to evict the item closest to expiring")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a sample size of 0 to panic")
+		}
+	}()
+	WithEvictionSampleSize(0)
+}
+
+func TestEvictLFU(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour, WithMaxItems(3), WithEvictionPolicy(EvictLFU))
+	defer tc.StopGc()
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Set("c", 3, DefaultExpiration)
+	for i := 0; i < 5; i++ {
+		tc.Get("a")
+		tc.Get("c")
+	}
+	tc.Set("d", 4, DefaultExpiration)
+	if _, found := tc.Get("b"); found {
+		t.Error("Expected b, the least frequently used item, to be evicted")
+	}
+	if tc.Count() != 3 {
+		t.Error("Expected 3 items, got", tc.Count())
+	}
+}
+
+func TestCountExpiredTowardCapacity(t *testing.T) {
+	for _, count := range []bool{true, false} {
+		tc := NewCache(DefaultExpiration, time.Hour, WithMaxItems(4), WithCountExpiredTowardCapacity(count))
+		defer tc.StopGc()
+		reasons := map[string]EvictReason{}
+		tc.OnEvictedWithReason(func(k string, v interface{}, reason EvictReason) {
+			reasons[k] = reason
+		})
+		tc.Set("live", 0, NoExpiration)
+		for i := 0; i < 3; i++ {
+			tc.Set(strconv.Itoa(i), i, time.Nanosecond)
+		}
+		<-time.After(time.Millisecond)
+		tc.Set("new", 1, NoExpiration)
+		tc.Set("newer", 2, NoExpiration)
+		if _, found := tc.Get("live"); !found {
+			t.Error("Expected the live item to be kept while expired ones remain, count:", count)
+		}
+		if count {
+			if len(reasons) != 2 || tc.Count() != 4 {
+				t.Error("Expected expired items to be evicted one by one, got", reasons, tc.Count())
+			}
+			continue
+		}
+		if len(reasons) != 3 || tc.Count() != 3 || tc.Stats().Expired != 3 {
+			t.Error("Expected all the expired items to be reclaimed at once, got", reasons, tc.Count())
+		}
+		for k, reason := range reasons {
+			if reason != EvictExpired {
+				t.Error("Expected reclaimed items to be evicted as expired:", k, reason)
+			}
+		}
+	}
+}
+
+func TestCountExpiredTowardCapacityLikeGC(t *testing.T) {
+	ch := make(chan KeyItem, 10)
+	tc := NewCache(DefaultExpiration, time.Hour, WithMaxItems(2), WithCountExpiredTowardCapacity(false), WithExpiredChannel(ch))
+	defer tc.StopGc()
+	tc.Set("a", 1, time.Nanosecond)
+	tc.Set("b", 2, NoExpiration)
+	<-time.After(time.Millisecond)
+	tc.Set("c", 3, NoExpiration)
+	select {
+	case ki := <-ch:
+		if ki.Key != "a" || ki.Item.Object != 1 {
+			t.Error("Unexpected expiry notification:", ki)
+		}
+	default:
+		t.Error("Expected the reclaimed item to be sent to the expired channel")
+	}
+
+	tc = NewCache(DefaultExpiration, time.Hour, WithMaxItems(2), WithCountExpiredTowardCapacity(false), WithStaleGrace(time.Hour))
+	defer tc.StopGc()
+	reasons := map[string]EvictReason{}
+	tc.OnEvictedWithReason(func(k string, v interface{}, reason EvictReason) {
+		reasons[k] = reason
+	})
+	tc.Set("a", 1, time.Nanosecond)
+	tc.Set("b", 2, NoExpiration)
+	<-time.After(time.Millisecond)
+	tc.Set("c", 3, NoExpiration)
+	if tc.Stats().Expired != 0 || len(reasons) != 1 || reasons["a"] != EvictCapacity {
+		t.Error("Expected items within the stale grace period not to be reclaimed as expired, got", reasons, tc.Stats().Expired)
+	}
+}
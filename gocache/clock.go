@@ -0,0 +1,36 @@
+package gocache
+
+import "time"
+
+// WithMonotonicClock computes and checks expirations with the monotonic clock, so TTLs aren't stretched or cut short
+// when the wall clock jumps, e.g. on NTP corrections. Expirations are then the wall-clock time at creation of the cache
+// plus the monotonic time elapsed since, which drifts from the wall clock whenever it's adjusted.
+// Item.Expired, which has no access to the cache, keeps using the wall clock.
+func WithMonotonicClock() Option {
+	return func(c *Cache) {
+		c.clockBase = time.Now()
+	}
+}
+
+// now returns the current time in nanoseconds, the clock expirations are based on.
+func (c *Cache) now() int64 {
+	if c.clockBase.IsZero() {
+		return time.Now().UnixNano()
+	}
+	return c.clockBase.UnixNano() + int64(time.Since(c.clockBase))
+}
+
+// deadline returns the expiration of an item living for d from now.
+func (c *Cache) deadline(d time.Duration) int64 {
+	return c.now() + int64(d)
+}
+
+// expired returns true if the item has expired.
+func (c *Cache) expired(item Item) bool {
+	return item.Expiration != 0 && c.now() > item.Expiration
+}
+
+// ttl returns the time left until the item expires, meaningless for items that never expire.
+func (c *Cache) ttl(item Item) time.Duration {
+	return time.Duration(item.Expiration - c.now())
+}
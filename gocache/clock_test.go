@@ -0,0 +1,27 @@
+package gocache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMonotonicClock(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour, WithMonotonicClock())
+	defer tc.StopGc()
+	tc.Set("a", 1, time.Minute)
+	tc.Set("b", 2, time.Millisecond)
+	if _, found := tc.Get("a"); !found {
+		t.Error("Expected a to be live")
+	}
+	<-time.After(5 * time.Millisecond)
+	if _, found := tc.Get("b"); found {
+		t.Error("Expected b to expire on the monotonic clock")
+	}
+	tc.DeleteExpired()
+	if tc.Count() != 1 {
+		t.Error("Expected the GC to use the monotonic clock, got", tc.Count())
+	}
+	if d := tc.ttl(tc.items["a"]); d <= 0 || d > time.Minute {
+		t.Error("Unexpected TTL:", d)
+	}
+}
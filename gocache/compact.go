@@ -0,0 +1,237 @@
+package gocache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"math"
+)
+
+// compactMagic starts every CompactSerializer snapshot.
+const compactMagic = "GCC1"
+
+// Value tags of the compact format.
+const (
+	compactNil byte = iota
+	compactBool
+	compactInt
+	compactInt8
+	compactInt16
+	compactInt32
+	compactInt64
+	compactUint
+	compactUint8
+	compactUint16
+	compactUint32
+	compactUint64
+	compactFloat32
+	compactFloat64
+	compactString
+	compactBytes
+	compactGob
+)
+
+// CompactSerializer is a Serializer with a compact binary format for string keys and values of basic types,
+// which it writes as varints or raw bytes, falling back to gob for each value of any other type.
+// For caches of small numbers and strings, its snapshots are much smaller and faster to load than gob ones.
+type CompactSerializer struct{}
+
+// Encode writes items to w.
+func (CompactSerializer) Encode(w io.Writer, items map[string]Item) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(compactMagic)
+	var buf [binary.MaxVarintLen64]byte
+	putUvarint := func(x uint64) {
+		bw.Write(buf[:binary.PutUvarint(buf[:], x)])
+	}
+	putVarint := func(x int64) {
+		bw.Write(buf[:binary.PutVarint(buf[:], x)])
+	}
+	putBytes := func(b []byte) {
+		putUvarint(uint64(len(b)))
+		bw.Write(b)
+	}
+	putUvarint(uint64(len(items)))
+	for k, v := range items {
+		putBytes([]byte(k))
+		putVarint(v.Expiration)
+		putUvarint(v.Version)
+		putVarint(v.Created)
+		switch o := v.Object.(type) {
+		case nil:
+			bw.WriteByte(compactNil)
+		case bool:
+			bw.WriteByte(compactBool)
+			if o {
+				bw.WriteByte(1)
+			} else {
+				bw.WriteByte(0)
+			}
+		case int:
+			bw.WriteByte(compactInt)
+			putVarint(int64(o))
+		case int8:
+			bw.WriteByte(compactInt8)
+			putVarint(int64(o))
+		case int16:
+			bw.WriteByte(compactInt16)
+			putVarint(int64(o))
+		case int32:
+			bw.WriteByte(compactInt32)
+			putVarint(int64(o))
+		case int64:
+			bw.WriteByte(compactInt64)
+			putVarint(o)
+		case uint:
+			bw.WriteByte(compactUint)
+			putUvarint(uint64(o))
+		case uint8:
+			bw.WriteByte(compactUint8)
+			putUvarint(uint64(o))
+		case uint16:
+			bw.WriteByte(compactUint16)
+			putUvarint(uint64(o))
+		case uint32:
+			bw.WriteByte(compactUint32)
+			putUvarint(uint64(o))
+		case uint64:
+			bw.WriteByte(compactUint64)
+			putUvarint(o)
+		case float32:
+			bw.WriteByte(compactFloat32)
+			putUvarint(uint64(math.Float32bits(o)))
+		case float64:
+			bw.WriteByte(compactFloat64)
+			putUvarint(math.Float64bits(o))
+		case string:
+			bw.WriteByte(compactString)
+			putBytes([]byte(o))
+		case []byte:
+			bw.WriteByte(compactBytes)
+			putBytes(o)
+		default:
+			if err := register(o); err != nil {
+				return fmt.Errorf("Error registering item %s with Gob library: %v", k, err)
+			}
+			var b bytes.Buffer
+			if err := gob.NewEncoder(&b).Encode(&v.Object); err != nil {
+				return fmt.Errorf("Error encoding item %s: %v", k, err)
+			}
+			bw.WriteByte(compactGob)
+			putBytes(b.Bytes())
+		}
+	}
+	return bw.Flush()
+}
+
+// Decode reads items from r.
+func (CompactSerializer) Decode(r io.Reader) (map[string]Item, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(compactMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return nil, err
+	}
+	if string(magic) != compactMagic {
+		return nil, fmt.Errorf("Not a compact snapshot")
+	}
+	getBytes := func() ([]byte, error) {
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		// Grow as data is read, instead of trusting the length up front
+		var b bytes.Buffer
+		if _, err = io.CopyN(&b, br, int64(n)); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	}
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	items := map[string]Item{}
+	for i := uint64(0); i < n; i++ {
+		k, err := getBytes()
+		if err != nil {
+			return nil, err
+		}
+		var v Item
+		if v.Expiration, err = binary.ReadVarint(br); err != nil {
+			return nil, err
+		}
+		if v.Version, err = binary.ReadUvarint(br); err != nil {
+			return nil, err
+		}
+		if v.Created, err = binary.ReadVarint(br); err != nil {
+			return nil, err
+		}
+		if v.Object, err = decodeCompactValue(br, getBytes); err != nil {
+			return nil, fmt.Errorf("Error decoding item %s: %v", k, err)
+		}
+		items[string(k)] = v
+	}
+	return items, nil
+}
+
+// decodeCompactValue reads a tagged value written by CompactSerializer.Encode.
+func decodeCompactValue(br *bufio.Reader, getBytes func() ([]byte, error)) (interface{}, error) {
+	tag, err := br.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch tag {
+	case compactNil:
+		return nil, nil
+	case compactBool:
+		b, err := br.ReadByte()
+		return b != 0, err
+	case compactInt, compactInt8, compactInt16, compactInt32, compactInt64:
+		x, err := binary.ReadVarint(br)
+		switch tag {
+		case compactInt:
+			return int(x), err
+		case compactInt8:
+			return int8(x), err
+		case compactInt16:
+			return int16(x), err
+		case compactInt32:
+			return int32(x), err
+		}
+		return x, err
+	case compactUint, compactUint8, compactUint16, compactUint32, compactUint64, compactFloat32, compactFloat64:
+		x, err := binary.ReadUvarint(br)
+		switch tag {
+		case compactUint:
+			return uint(x), err
+		case compactUint8:
+			return uint8(x), err
+		case compactUint16:
+			return uint16(x), err
+		case compactUint32:
+			return uint32(x), err
+		case compactFloat32:
+			return math.Float32frombits(uint32(x)), err
+		case compactFloat64:
+			return math.Float64frombits(x), err
+		}
+		return x, err
+	case compactString:
+		b, err := getBytes()
+		return string(b), err
+	case compactBytes:
+		return getBytes()
+	case compactGob:
+		b, err := getBytes()
+		if err != nil {
+			return nil, err
+		}
+		var v interface{}
+		err = gob.NewDecoder(bytes.NewReader(b)).Decode(&v)
+		return v, err
+	}
+	return nil, fmt.Errorf("Unknown value tag %d", tag)
+}
@@ -0,0 +1,81 @@
+package gocache
+
+import (
+	"bytes"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCompactSerializer(t *testing.T) {
+	values := map[string]interface{}{
+		"nil":     nil,
+		"bool":    true,
+		"int":     -1,
+		"int8":    int8(-8),
+		"int16":   int16(-16),
+		"int32":   int32(-32),
+		"int64":   int64(-64),
+		"uint":    uint(1),
+		"uint8":   uint8(8),
+		"uint16":  uint16(16),
+		"uint32":  uint32(32),
+		"uint64":  uint64(64),
+		"float32": float32(3.2),
+		"float64": 6.4,
+		"string":  "string",
+		"bytes":   []byte("bytes"),
+		"struct":  gobTypeStruct{A: 1},
+	}
+	tc := NewCache(DefaultExpiration, time.Hour, WithSerializer(CompactSerializer{}))
+	defer tc.StopGc()
+	for k, v := range values {
+		tc.Set(k, v, time.Hour)
+	}
+	var buf bytes.Buffer
+	if err := tc.Save(&buf); err != nil {
+		t.Fatal("Couldn't save cache:", err)
+	}
+	oc := NewCache(DefaultExpiration, time.Hour, WithSerializer(CompactSerializer{}))
+	defer oc.StopGc()
+	if err := oc.Load(&buf); err != nil {
+		t.Fatal("Couldn't load cache:", err)
+	}
+	for k, want := range values {
+		got, found := oc.Get(k)
+		if !found || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s didn't round-trip: %#v", k, got)
+		}
+		a, _ := tc.GetItem(k)
+		b, _ := oc.GetItem(k)
+		if a.Expiration != b.Expiration || a.Created != b.Created {
+			t.Errorf("%s metadata didn't round-trip", k)
+		}
+	}
+
+	if _, err := (CompactSerializer{}).Decode(bytes.NewReader([]byte("garbage"))); err == nil {
+		t.Error("Expected garbage to fail to decode")
+	}
+	tc.Set("func", func() {}, DefaultExpiration)
+	if err := tc.Save(&buf); err == nil {
+		t.Error("Expected an unencodable value to fail")
+	}
+}
+
+func TestCompactSerializerSize(t *testing.T) {
+	compact := NewCache(DefaultExpiration, time.Hour, WithSerializer(CompactSerializer{}))
+	defer compact.StopGc()
+	gob := NewCache(DefaultExpiration, time.Hour)
+	defer gob.StopGc()
+	for i := 0; i < 1000; i++ {
+		compact.Set(strconv.Itoa(i), i, DefaultExpiration)
+		gob.Set(strconv.Itoa(i), i, DefaultExpiration)
+	}
+	var cb, gb bytes.Buffer
+	compact.Save(&cb)
+	gob.Save(&gb)
+	if cb.Len() >= gb.Len()*2/3 {
+		t.Errorf("Expected the compact snapshot to be much smaller, got %d bytes vs %d", cb.Len(), gb.Len())
+	}
+}
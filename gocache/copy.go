@@ -0,0 +1,89 @@
+package gocache
+
+import "reflect"
+
+// WithDeepCopy sets the function GetImmutable uses to copy values, instead of the reflection-based default,
+// e.g. for types with their own Clone method or holding unexported references.
+func WithDeepCopy(f func(interface{}) interface{}) Option {
+	return func(c *Cache) {
+		c.deepCopy = f
+	}
+}
+
+// GetImmutable is like Get but returns a deep copy of the value, sharing no memory with the cached one,
+// so nothing the caller does to it can affect the cache. Copying walks the whole value on every call,
+// allocating as much as the value itself, so it's much more expensive than Get or GetCopy.
+// The default copy follows pointers, slices, maps, arrays, interfaces and exported struct fields;
+// unexported fields are copied shallowly, and functions and channels are shared. Use WithDeepCopy otherwise.
+func (c *Cache) GetImmutable(k string) (interface{}, bool) {
+	v, found := c.Get(k)
+	if !found {
+		return nil, false
+	}
+	if c.deepCopy != nil {
+		return c.deepCopy(v), true
+	}
+	if v == nil {
+		return nil, true
+	}
+	return deepCopy(reflect.ValueOf(v), map[uintptr]reflect.Value{}).Interface(), true
+}
+
+// deepCopy returns a deep copy of v, copied keeps the copies of the pointers already seen, so cycles are preserved.
+func deepCopy(v reflect.Value, copied map[uintptr]reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		if cp, found := copied[v.Pointer()]; found {
+			return cp
+		}
+		cp := reflect.New(v.Type().Elem())
+		copied[v.Pointer()] = cp
+		cp.Elem().Set(deepCopy(v.Elem(), copied))
+		return cp
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		cp := reflect.New(v.Type()).Elem()
+		cp.Set(deepCopy(v.Elem(), copied))
+		return cp
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		cp := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			cp.Index(i).Set(deepCopy(v.Index(i), copied))
+		}
+		return cp
+	case reflect.Array:
+		cp := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			cp.Index(i).Set(deepCopy(v.Index(i), copied))
+		}
+		return cp
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		cp := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			cp.SetMapIndex(deepCopy(iter.Key(), copied), deepCopy(iter.Value(), copied))
+		}
+		return cp
+	case reflect.Struct:
+		cp := reflect.New(v.Type()).Elem()
+		cp.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if f := cp.Field(i); f.CanSet() {
+				f.Set(deepCopy(v.Field(i), copied))
+			}
+		}
+		return cp
+	}
+	return v
+}
@@ -0,0 +1,62 @@
+package gocache
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type node struct {
+	Name     string
+	Tags     []string
+	Attrs    map[string]interface{}
+	Next     *node
+	Children [2]*node
+}
+
+func TestGetImmutable(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	n := &node{
+		Name:  "root",
+		Tags:  []string{"a"},
+		Attrs: map[string]interface{}{"list": []int{1}},
+	}
+	n.Next = n
+	n.Children[0] = &node{Name: "child"}
+	tc.Set("n", n, DefaultExpiration)
+
+	v, found := tc.GetImmutable("n")
+	if !found {
+		t.Fatal("Expected n to be found")
+	}
+	cp := v.(*node)
+	if cp == n || cp.Next != cp || cp.Children[0] == n.Children[0] {
+		t.Error("Expected pointers to be copied, preserving cycles")
+	}
+	cp.Tags[0] = "b"
+	cp.Attrs["list"].([]int)[0] = 2
+	cp.Children[0].Name = "changed"
+	if !reflect.DeepEqual(n.Tags, []string{"a"}) || n.Attrs["list"].([]int)[0] != 1 || n.Children[0].Name != "child" {
+		t.Error("Mutating the copy changed the cached value")
+	}
+
+	if v, _ := tc.GetImmutable("missing"); v != nil {
+		t.Error("Expected a miss, got", v)
+	}
+	tc.Set("nil", nil, DefaultExpiration)
+	if v, found := tc.GetImmutable("nil"); !found || v != nil {
+		t.Error("Expected a nil value, got", v)
+	}
+}
+
+func TestDeepCopyOption(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour, WithDeepCopy(func(v interface{}) interface{} {
+		return "copied"
+	}))
+	defer tc.StopGc()
+	tc.Set("a", 1, DefaultExpiration)
+	if v, _ := tc.GetImmutable("a"); v != "copied" {
+		t.Error("Expected the configured copy to be used, got", v)
+	}
+}
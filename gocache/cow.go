@@ -0,0 +1,59 @@
+package gocache
+
+// WithCopyOnWrite makes Get lock-free: it reads an immutable snapshot of the items, which every write
+// replaces with a fresh copy once it releases the lock. Writes then cost a copy of the whole cache,
+// so it's only appropriate for read-mostly caches, small or rarely written, whose reads contend on the lock.
+// Get still takes the read lock with WithEvictionPolicy(EvictLFU) or WithAccessCounts, which it updates,
+// and with WithSpill.
+func WithCopyOnWrite() Option {
+	return func(c *Cache) {
+		c.cow = true
+		c.snapshotStale = true
+	}
+}
+
+// publishSnapshot replaces the snapshot read by Get with a copy of the items if they changed,
+// it must be called with the write lock held.
+func (c *Cache) publishSnapshot() {
+	if !c.snapshotStale {
+		return
+	}
+	items := make(map[string]Item, len(c.items))
+	for k, v := range c.items {
+		items[k] = v
+	}
+	c.snapshot.Store(items)
+	c.snapshotStale = false
+}
+
+// lockFree returns whether Get can read the snapshot without the lock.
+func (c *Cache) lockFree() bool {
+	return c.cow && c.sketch == nil && c.accesses == nil && c.spillDir == ""
+}
+
+// ItemsSnapshot returns a copy of the items live at a single point in time: it includes every item present then
+// and none deleted before, unlike a view assembled from successive reads. Expiration is checked as of that instant.
+// It copies the items with the read lock held, or without any lock from the WithCopyOnWrite snapshot.
+func (c *Cache) ItemsSnapshot() map[string]Item {
+	var items map[string]Item
+	var now int64
+	// Spilled values are read from files that may be removed once the lock is released
+	if c.cow && c.spillDir == "" {
+		items, now = c.snapshot.Load().(map[string]Item), c.now()
+	} else {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		items, now = c.items, c.now()
+	}
+	snapshot := make(map[string]Item, len(items))
+	for k, v := range items {
+		if v.Expiration > 0 && now > v.Expiration {
+			continue
+		}
+		if obj, ok := unspill(v.Object); ok {
+			v.Object = obj
+			snapshot[k] = v
+		}
+	}
+	return snapshot
+}
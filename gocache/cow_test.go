@@ -0,0 +1,114 @@
+package gocache
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCopyOnWrite(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour, WithCopyOnWrite())
+	defer tc.StopGc()
+	if _, found := tc.Get("a"); found {
+		t.Error("Expected an empty cache")
+	}
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, time.Nanosecond)
+	<-time.After(time.Millisecond)
+	if v, found := tc.Get("a"); !found || v.(int) != 1 {
+		t.Error("Expected the snapshot to have a, got", v, found)
+	}
+	if _, found := tc.Get("b"); found {
+		t.Error("Expected expired items to be missing")
+	}
+	tc.Delete("a")
+	if _, found := tc.Get("a"); found {
+		t.Error("Expected the snapshot to drop deleted items")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				tc.Get(strconv.Itoa(j))
+			}
+		}()
+	}
+	for j := 0; j < 100; j++ {
+		tc.Set(strconv.Itoa(j), j, DefaultExpiration)
+	}
+	wg.Wait()
+	if v, found := tc.Get("99"); !found || v.(int) != 99 {
+		t.Error("Expected the last write to be visible, got", v, found)
+	}
+	tc.Clear()
+	if _, found := tc.Get("99"); found {
+		t.Error("Expected Clear to empty the snapshot")
+	}
+}
+
+func BenchmarkGetParallel(b *testing.B) {
+	benchmarkGetParallel(b, NewCache(DefaultExpiration, time.Hour))
+}
+
+func BenchmarkGetParallelCopyOnWrite(b *testing.B) {
+	benchmarkGetParallel(b, NewCache(DefaultExpiration, time.Hour, WithCopyOnWrite()))
+}
+
+func benchmarkGetParallel(b *testing.B, tc *Cache) {
+	defer tc.StopGc()
+	for i := 0; i < 1000; i++ {
+		tc.Set(strconv.Itoa(i), i, DefaultExpiration)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			tc.Get(strconv.Itoa(i % 1000))
+			i++
+		}
+	})
+}
+
+func TestItemsSnapshot(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithCopyOnWrite()}} {
+		tc := NewCache(DefaultExpiration, time.Hour, opts...)
+		defer tc.StopGc()
+		tc.Set("a", 1, DefaultExpiration)
+		tc.Set("b", 2, DefaultExpiration)
+		tc.Set("expired", 3, time.Nanosecond)
+		<-time.After(time.Millisecond)
+		snapshot := tc.ItemsSnapshot()
+		tc.Delete("a")
+		tc.Set("c", 4, DefaultExpiration)
+		if len(snapshot) != 2 || snapshot["a"].Object != 1 || snapshot["b"].Object != 2 {
+			t.Error("Unexpected snapshot:", snapshot)
+		}
+
+		// Pairs of keys are always written together, so a consistent snapshot never holds just one of them
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 200; i++ {
+				tc.Transact(func(tx *Tx) {
+					tx.Set("x"+strconv.Itoa(i), i, DefaultExpiration)
+					tx.Set("y"+strconv.Itoa(i), i, DefaultExpiration)
+				})
+			}
+		}()
+		for i := 0; i < 50; i++ {
+			s := tc.ItemsSnapshot()
+			for k := range s {
+				if k[0] == 'x' {
+					if _, found := s["y"+k[1:]]; !found {
+						t.Fatal("Inconsistent snapshot, missing the pair of", k)
+					}
+				}
+			}
+		}
+		<-done
+	}
+}
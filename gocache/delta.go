@@ -0,0 +1,97 @@
+package gocache
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+)
+
+// delta is the set of changes written by SaveDelta.
+type delta struct {
+	Items   map[string]Item
+	Deleted []string
+}
+
+// WithDeltaTracking tracks the keys changed since the last SaveDelta, which SaveDelta requires.
+func WithDeltaTracking() Option {
+	return func(c *Cache) {
+		c.dirty = map[string]struct{}{}
+	}
+}
+
+// markDirty records that k changed, it must be called with the write lock held.
+func (c *Cache) markDirty(k string) {
+	if c.cow {
+		c.snapshotStale = true
+	}
+	if c.dirty != nil {
+		c.dirty[k] = struct{}{}
+	}
+}
+
+// SaveDelta writes with gob the items set and the keys deleted since the last SaveDelta,
+// for ApplyDelta to merge them into another cache. The tracked changes are reset atomically when taken,
+// and restored if writing fails. It requires WithDeltaTracking.
+func (c *Cache) SaveDelta(w io.Writer) error {
+	d := delta{Items: map[string]Item{}}
+	c.mu.Lock()
+	if c.dirty == nil {
+		c.mu.Unlock()
+		return fmt.Errorf("Delta tracking is not enabled")
+	}
+	dirty := c.dirty
+	c.dirty = map[string]struct{}{}
+	for k := range dirty {
+		if v, found := c.items[k]; found {
+			if v.Object, found = unspill(v.Object); found {
+				d.Items[k] = v
+			}
+		} else {
+			d.Deleted = append(d.Deleted, k)
+		}
+	}
+	c.mu.Unlock()
+
+	err := func() error {
+		if !c.gobRegistered {
+			if err := registerItems(d.Items); err != nil {
+				return err
+			}
+		}
+		return itemEncodeError(d.Items, gob.NewEncoder(w).Encode(&d))
+	}()
+	if err != nil {
+		c.mu.Lock()
+		for k := range dirty {
+			c.dirty[k] = struct{}{}
+		}
+		c.mu.Unlock()
+	}
+	return err
+}
+
+// ApplyDelta reads a delta written by SaveDelta and applies it, overwriting the items it sets
+// and deleting the keys it deleted. Items that Set would reject are skipped.
+func (c *Cache) ApplyDelta(r io.Reader) error {
+	var d delta
+	if err := gob.NewDecoder(r).Decode(&d); err != nil {
+		return err
+	}
+	for k, v := range d.Items {
+		if v.Expiration < 0 {
+			return fmt.Errorf("Item %s has invalid expiration %d", k, v.Expiration)
+		}
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	if err := c.writable(); err != nil {
+		return err
+	}
+	for k, v := range d.Items {
+		c.put(k, v)
+	}
+	for _, k := range d.Deleted {
+		c.del(k, EvictDeleted)
+	}
+	return nil
+}
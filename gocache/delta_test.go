@@ -0,0 +1,64 @@
+package gocache
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestDelta(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour, WithDeltaTracking())
+	defer tc.StopGc()
+	oc := NewCache(DefaultExpiration, time.Hour)
+	defer oc.StopGc()
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	var buf bytes.Buffer
+	if err := tc.SaveDelta(&buf); err != nil {
+		t.Fatal("Couldn't save delta:", err)
+	}
+	if err := oc.ApplyDelta(&buf); err != nil {
+		t.Fatal("Couldn't apply delta:", err)
+	}
+
+	tc.Set("a", 3, DefaultExpiration)
+	tc.Delete("b")
+	tc.Set("c", 4, DefaultExpiration)
+	buf.Reset()
+	if err := tc.SaveDelta(&buf); err != nil {
+		t.Fatal("Couldn't save delta:", err)
+	}
+	full := buf.Len()
+	if err := oc.ApplyDelta(&buf); err != nil {
+		t.Fatal("Couldn't apply delta:", err)
+	}
+	if x, _ := oc.Get("a"); x != 3 {
+		t.Error("a wasn't updated by the delta:", x)
+	}
+	if _, found := oc.Get("b"); found {
+		t.Error("b wasn't deleted by the delta")
+	}
+	if x, _ := oc.Get("c"); x != 4 {
+		t.Error("c wasn't added by the delta:", x)
+	}
+
+	buf.Reset()
+	if err := tc.SaveDelta(&buf); err != nil {
+		t.Fatal("Couldn't save delta:", err)
+	}
+	if buf.Len() >= full {
+		t.Error("Expected an empty delta after saving, got", buf.Len(), "bytes")
+	}
+
+	tc.Set("fn", func() {}, DefaultExpiration)
+	if err := tc.SaveDelta(&buf); err == nil {
+		t.Error("Expected an error saving a function")
+	}
+	if _, found := tc.dirty["fn"]; !found {
+		t.Error("The changes weren't restored after a failed save")
+	}
+
+	if err := oc.SaveDelta(&buf); err == nil {
+		t.Error("Expected an error saving a delta without tracking")
+	}
+}
@@ -0,0 +1,76 @@
+package gocache
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxDumpValueLength bounds the length of each value printed by Dump.
+const maxDumpValueLength = 64
+
+// Dump returns a human-readable listing of the live items sorted by key, one per line,
+// with their value truncated to a bounded length and their remaining TTL. It's meant for diagnostics only.
+func (c *Cache) Dump() string {
+	items := c.ItemsByExpiration()
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Key < items[j].Key
+	})
+	var b strings.Builder
+	for _, ki := range items {
+		v := fmt.Sprintf("%v", ki.Item.Object)
+		if len(v) > maxDumpValueLength {
+			n := maxDumpValueLength
+			for n > 0 && !utf8.RuneStart(v[n]) {
+				n--
+			}
+			v = v[:n] + "..."
+		}
+		ttl := "no expiration"
+		if ki.Item.Expiration > 0 {
+			ttl = "ttl " + c.ttl(ki.Item).Round(time.Millisecond).String()
+		}
+		fmt.Fprintf(&b, "%q: %s (%s)\n", ki.Key, v, ttl)
+	}
+	return b.String()
+}
+
+// ExportCSV writes the live items to w as CSV for ad-hoc analysis, one row per item sorted by key,
+// with the columns key, value formatted by fmt.Sprint and expiration in RFC 3339 format, empty if it never expires.
+// It's lossy for anything but simple values, use Save for snapshots.
+func (c *Cache) ExportCSV(w io.Writer) error {
+	c.mu.RLock()
+	items := make([]KeyItem, 0, len(c.items))
+	for k, v := range c.items {
+		if c.expired(v) {
+			continue
+		}
+		if obj, ok := unspill(v.Object); ok {
+			v.Object = obj
+			items = append(items, KeyItem{Key: k, Item: v})
+		}
+	}
+	c.mu.RUnlock()
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Key < items[j].Key
+	})
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"key", "value", "expiration"}); err != nil {
+		return err
+	}
+	for _, ki := range items {
+		var expiration string
+		if ki.Item.Expiration > 0 {
+			expiration = time.Unix(0, ki.Item.Expiration).UTC().Format(time.RFC3339Nano)
+		}
+		if err := cw.Write([]string{ki.Key, fmt.Sprint(ki.Item.Object), expiration}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
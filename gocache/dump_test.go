@@ -0,0 +1,48 @@
+package gocache
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDump(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	tc.Set("b", strings.Repeat("x", 1000), time.Hour)
+	tc.Set("a", 1, NoExpiration)
+	tc.Set("expired", 2, time.Nanosecond)
+	<-time.After(time.Millisecond)
+	lines := strings.Split(strings.TrimSuffix(tc.Dump(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatal("Expected 2 lines, got", lines)
+	}
+	if lines[0] != `"a": 1 (no expiration)` {
+		t.Error("Unexpected line for a:", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], `"b": xxx`) || !strings.Contains(lines[1], "... (ttl ") || len(lines[1]) > 100 {
+		t.Error("Unexpected line for b:", lines[1])
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	tc.Set("b", "x,y", time.Hour)
+	tc.Set("a", 1, NoExpiration)
+	tc.Set("expired", 2, time.Nanosecond)
+	<-time.After(time.Millisecond)
+	var b strings.Builder
+	if err := tc.ExportCSV(&b); err != nil {
+		t.Fatal("ExportCSV failed:", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if len(lines) != 3 || lines[0] != "key,value,expiration" || lines[1] != "a,1," {
+		t.Fatal("Unexpected CSV:", lines)
+	}
+	item, _ := tc.GetItem("b")
+	want := `b,"x,y",` + time.Unix(0, item.Expiration).UTC().Format(time.RFC3339Nano)
+	if lines[2] != want {
+		t.Error("Unexpected row for b:", lines[2])
+	}
+}
@@ -0,0 +1,202 @@
+package gocache
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// EventOp is the kind of change reported by an Event.
+type EventOp int
+
+const (
+	// EventSet reports that a key was set.
+	EventSet EventOp = iota
+	// EventDelete reports that a key was deleted or expired.
+	EventDelete
+)
+
+// Event is a change of a key delivered to subscribers.
+type Event struct {
+	Op    EventOp
+	Key   string
+	Value interface{}
+}
+
+type subscriber struct {
+	ch     chan Event
+	match  func(string) bool
+	mu     sync.Mutex // guards sending to ch against closing it
+	closed bool
+}
+
+// published is an event queued for the subscribers at the time it was published.
+type published struct {
+	e    Event
+	subs []*subscriber
+}
+
+// Subscribe returns a channel receiving an Event for every change of a key, buffered to size,
+// and a function cancelling the subscription and closing the channel.
+// Events that don't fit in the buffer are dropped so writers never block on slow subscribers.
+// Clear doesn't publish any event.
+func (c *Cache) Subscribe(size int) (<-chan Event, func()) {
+	return c.subscribe(size, nil)
+}
+
+// SubscribePrefix is like Subscribe but only delivers the changes of the keys starting with prefix.
+func (c *Cache) SubscribePrefix(size int, prefix string) (<-chan Event, func()) {
+	return c.subscribe(size, func(k string) bool {
+		return strings.HasPrefix(k, prefix)
+	})
+}
+
+// SubscribeFunc is like Subscribe but only delivers the changes of the keys for which match returns true.
+// match is called without holding the cache lock, like other callbacks, when each event is delivered.
+func (c *Cache) SubscribeFunc(size int, match func(k string) bool) (<-chan Event, func()) {
+	return c.subscribe(size, match)
+}
+
+func (c *Cache) subscribe(size int, match func(string) bool) (<-chan Event, func()) {
+	s := &subscriber{
+		ch:    make(chan Event, size),
+		match: match,
+	}
+	c.mu.Lock()
+	// The slice is replaced rather than modified, since queued events keep the subscribers of their time
+	c.subs = append(append([]*subscriber(nil), c.subs...), s)
+	c.mu.Unlock()
+	return s.ch, func() {
+		c.mu.Lock()
+		subs := make([]*subscriber, 0, len(c.subs))
+		for _, other := range c.subs {
+			if other != s {
+				subs = append(subs, other)
+			}
+		}
+		c.subs = subs
+		c.mu.Unlock()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if !s.closed {
+			s.closed = true
+			close(s.ch)
+		}
+	}
+}
+
+// publish queues an event for the subscribers, it must be called with the write lock held.
+// The events are delivered by unlock once the lock is released.
+func (c *Cache) publish(op EventOp, k string, v interface{}) {
+	if len(c.subs) == 0 {
+		return
+	}
+	c.published = append(c.published, published{e: Event{Op: op, Key: k, Value: v}, subs: c.subs})
+}
+
+// eventBatch is the events published while the write lock was held once.
+// ready is closed once their spilled values are read back, it's nil if there are none to read.
+type eventBatch struct {
+	events []published
+	ready  chan struct{}
+}
+
+// queueEvents moves the events published while the write lock was held to the delivery queue,
+// and returns their batch, or nil if there are none. It must be called with the write lock held.
+func (c *Cache) queueEvents() *eventBatch {
+	if len(c.published) == 0 {
+		return nil
+	}
+	batch := &eventBatch{events: c.published}
+	for _, p := range c.published {
+		if _, ok := p.e.Value.(*spilled); ok {
+			batch.ready = make(chan struct{})
+			break
+		}
+	}
+	c.eventsMu.Lock()
+	c.eventQueue = append(c.eventQueue, batch)
+	c.eventsMu.Unlock()
+	c.published = nil
+	return batch
+}
+
+// unspill reads back the spilled values of the batch without holding the lock, then marks it ready.
+func (b *eventBatch) unspill() {
+	for i := range b.events {
+		b.events[i].e.Value, _ = unspill(b.events[i].e.Value)
+	}
+	close(b.ready)
+}
+
+// deliverEvents delivers the queued events, unless another goroutine is already delivering them,
+// in which case it delivers these too, so subscribers get the events in order.
+func (c *Cache) deliverEvents() {
+	c.eventsMu.Lock()
+	if c.delivering {
+		c.eventsMu.Unlock()
+		return
+	}
+	c.delivering = true
+	for len(c.eventQueue) > 0 {
+		queue := c.eventQueue
+		c.eventQueue = nil
+		c.eventsMu.Unlock()
+		for _, b := range queue {
+			if b.ready != nil {
+				<-b.ready
+			}
+			for _, p := range b.events {
+				for _, s := range p.subs {
+					c.deliver(s, p.e)
+				}
+			}
+		}
+		c.eventsMu.Lock()
+	}
+	c.delivering = false
+	c.eventsMu.Unlock()
+}
+
+// deliver sends e to s if it matches, dropping it if the buffer is full or s was cancelled.
+func (c *Cache) deliver(s *subscriber, e Event) {
+	if s.match != nil {
+		matched := false
+		c.safely(func() { matched = s.match(e.Key) })
+		if !matched {
+			return
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.ch <- e:
+	default:
+	}
+}
+
+// WaitGet returns the value of key k, waiting for it to be set if it isn't in the cache yet.
+// It returns false if ctx is done before that.
+func (c *Cache) WaitGet(ctx context.Context, k string) (interface{}, bool) {
+	events, cancel := c.subscribe(1, func(key string) bool {
+		return key == k
+	})
+	defer cancel()
+	if v, found := c.Get(k); found {
+		return v, true
+	}
+	for {
+		select {
+		case <-events:
+			// The buffer of one drops the events following an unread one, so check the cache itself
+			if v, found := c.Get(k); found {
+				return v, true
+			}
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+}
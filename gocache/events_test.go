@@ -0,0 +1,136 @@
+package gocache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSubscribe(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	events, cancel := tc.Subscribe(10)
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Delete("a")
+	tc.Delete("missing")
+	if e := <-events; e.Op != EventSet || e.Key != "a" || e.Value != 1 {
+		t.Error("Unexpected event:", e)
+	}
+	if e := <-events; e.Op != EventDelete || e.Key != "a" {
+		t.Error("Unexpected event:", e)
+	}
+	cancel()
+	if e, ok := <-events; ok {
+		t.Error("Received an event after cancelling:", e)
+	}
+	cancel()
+}
+
+func TestSubscribePrefix(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	users, cancelUsers := tc.SubscribePrefix(10, "user:")
+	defer cancelUsers()
+	odd, cancelOdd := tc.SubscribeFunc(10, func(k string) bool {
+		return len(k)%2 == 1
+	})
+	defer cancelOdd()
+	tc.Set("user:1", 1, DefaultExpiration)
+	tc.Set("order:1", 2, DefaultExpiration)
+	tc.Delete("user:1")
+	if len(users) != 2 {
+		t.Fatal("Expected the user events only, got", len(users))
+	}
+	if e := <-users; e.Op != EventSet || e.Key != "user:1" {
+		t.Error("Unexpected event:", e)
+	}
+	if e := <-users; e.Op != EventDelete || e.Key != "user:1" {
+		t.Error("Unexpected event:", e)
+	}
+	if len(odd) != 1 {
+		t.Fatal("Expected the odd-length key events only, got", len(odd))
+	}
+	if e := <-odd; e.Key != "order:1" {
+		t.Error("Unexpected event:", e)
+	}
+}
+
+func TestSubscribeFuncUnlocked(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	panicking, cancelPanicking := tc.SubscribeFunc(10, func(k string) bool {
+		panic("boom")
+	})
+	defer cancelPanicking()
+	reading, cancelReading := tc.SubscribeFunc(10, func(k string) bool {
+		_, found := tc.Get(k)
+		return found
+	})
+	defer cancelReading()
+	done := make(chan struct{})
+	go func() {
+		tc.Set("a", 1, DefaultExpiration)
+		tc.Set("b", 2, DefaultExpiration)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected match to be called without holding the lock")
+	}
+	if len(panicking) != 0 || tc.LastCallbackError() == nil {
+		t.Error("Expected the panic of match to be recovered, got", len(panicking), tc.LastCallbackError())
+	}
+	if e := <-reading; e.Key != "a" {
+		t.Error("Unexpected event:", e)
+	}
+	if e := <-reading; e.Key != "b" {
+		t.Error("Unexpected event:", e)
+	}
+}
+
+func TestWaitGet(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	go func() {
+		<-time.After(5 * time.Millisecond)
+		tc.Set("other", 0, DefaultExpiration)
+		tc.Set("a", 1, DefaultExpiration)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if v, found := tc.WaitGet(ctx, "a"); !found || v != 1 {
+		t.Error("Expected to get a once it's set, got", v, found)
+	}
+	if v, found := tc.WaitGet(ctx, "a"); !found || v != 1 {
+		t.Error("Expected to get a without waiting, got", v, found)
+	}
+
+	// A delete filling the subscription buffer, e.g. by the GC, must not hide the following set.
+	// The observer runs them right after the first lookup of WaitGet, before it reads any event.
+	var once sync.Once
+	var oc *Cache
+	oc = NewCache(DefaultExpiration, time.Hour, WithObserver(func(op, k string, hit bool, d time.Duration) {
+		if op == "Get" && k == "c" {
+			once.Do(func() {
+				oc.Delete("c")
+				oc.Set("c", 3, DefaultExpiration)
+			})
+		}
+	}))
+	defer oc.StopGc()
+	oc.Set("c", 0, time.Nanosecond)
+	<-time.After(time.Millisecond)
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if v, found := oc.WaitGet(ctx, "c"); !found || v != 3 {
+		t.Error("Expected to get c after a delete, got", v, found)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if _, found := tc.WaitGet(ctx, "b"); found {
+		t.Error("Found b although it was never set")
+	}
+}
@@ -0,0 +1,111 @@
+package gocache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// gobTypes maps the names of the types registered with gob by this package to the types,
+// so a fingerprinted snapshot can be checked against the local definitions.
+var gobTypes sync.Map
+
+// recordType remembers the type of v for fingerprint checks.
+func recordType(v interface{}) {
+	if v != nil {
+		t := reflect.TypeOf(v)
+		gobTypes.Store(typeName(t), t)
+	}
+}
+
+// typeName returns the package-qualified name of t.
+func typeName(t reflect.Type) string {
+	if t.Name() != "" && t.PkgPath() != "" {
+		return t.PkgPath() + "." + t.Name()
+	}
+	return t.String()
+}
+
+// fingerprints returns the fingerprints of the types of the item values, by type name.
+func fingerprints(items map[string]Item) map[string]string {
+	fps := map[string]string{}
+	for _, v := range items {
+		if v.Object == nil {
+			continue
+		}
+		t := reflect.TypeOf(v.Object)
+		name := typeName(t)
+		if _, found := fps[name]; !found {
+			fps[name] = fingerprint(t)
+		}
+	}
+	return fps
+}
+
+// checkFingerprints returns an error naming the first type, in name order, whose local definition
+// doesn't match its fingerprint in a snapshot. Types unknown locally are left for gob to report.
+func checkFingerprints(fps map[string]string) error {
+	names := make([]string, 0, len(fps))
+	for name := range fps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t, found := gobTypes.Load(name)
+		if found && fingerprint(t.(reflect.Type)) != fps[name] {
+			return fmt.Errorf("Type %s changed since the snapshot was saved", name)
+		}
+	}
+	return nil
+}
+
+// fingerprint returns a hash of the layout of t: its kind, and the names, types and tags of its fields.
+func fingerprint(t reflect.Type) string {
+	var b strings.Builder
+	describe(&b, t, map[reflect.Type]bool{})
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:8])
+}
+
+// describe writes the layout of t to b, only naming the types already in seen, which guards against cycles.
+func describe(b *strings.Builder, t reflect.Type, seen map[reflect.Type]bool) {
+	if t.Name() != "" {
+		b.WriteString(typeName(t))
+		if seen[t] {
+			return
+		}
+		seen[t] = true
+		b.WriteByte(' ')
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		b.WriteByte('*')
+		describe(b, t.Elem(), seen)
+	case reflect.Slice:
+		b.WriteString("[]")
+		describe(b, t.Elem(), seen)
+	case reflect.Array:
+		fmt.Fprintf(b, "[%d]", t.Len())
+		describe(b, t.Elem(), seen)
+	case reflect.Map:
+		b.WriteString("map[")
+		describe(b, t.Key(), seen)
+		b.WriteByte(']')
+		describe(b, t.Elem(), seen)
+	case reflect.Struct:
+		b.WriteString("struct{")
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			fmt.Fprintf(b, "%s %q ", f.Name, f.Tag)
+			describe(b, f.Type, seen)
+			b.WriteByte(';')
+		}
+		b.WriteByte('}')
+	default:
+		b.WriteString(t.Kind().String())
+	}
+}
@@ -1,11 +1,24 @@
+// Package gocache is an in-memory key/value cache with expiration.
+//
+// User-provided callbacks, such as the OnEvicted function, are always called without holding the cache lock,
+// so they may call back into the cache. The only exception is the WithSizeFunc functions, which must not.
+// Building with the gocache_debug tag makes the cache panic when a goroutine re-enters it while holding its lock,
+// instead of deadlocking.
 package gocache
 
 import (
-	"encoding/gob"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"math/rand"
 	"os"
+	"reflect"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,6 +26,8 @@ import (
 type Item struct {
 	Object     interface{} // Data
 	Expiration int64       // Expiration time
+	Version    uint64      // Version, increasing on every set
+	Created    int64       // Creation time, 0 if unknown
 }
 
 const (
@@ -22,13 +37,132 @@ const (
 	DefaultExpiration time.Duration = 0
 )
 
+// ErrKeyTooLong is returned when a key is longer than the limit set by WithMaxKeyLength.
+var ErrKeyTooLong = errors.New("Key is too long")
+
+// ErrValueTooLarge is returned when a value is larger than the limit set by WithMaxValueBytes.
+var ErrValueTooLarge = errors.New("Value is too large")
+
+// ErrClosed is returned when writing to a closed cache.
+var ErrClosed = errors.New("Cache is closed")
+
+// ErrTagLimit is returned by SetWithTags when the tags exceed the limits set by WithTagLimits.
+var ErrTagLimit = errors.New("Tag limit exceeded")
+
+// ErrFrozen is returned when writing to a frozen cache.
+var ErrFrozen = errors.New("Cache is frozen")
+
+// ErrCapacityExceeded is returned by Transact when a transaction sets more keys than WithMaxItems allows.
+var ErrCapacityExceeded = errors.New("Capacity exceeded")
+
+// KeyItem pairs an item with its key.
+type KeyItem struct {
+	Key  string
+	Item Item
+}
+
 // Cache is the cache entity.
 type Cache struct {
-	defaultExpiration time.Duration
-	items             map[string]Item
-	mu                sync.RWMutex
-	gcInterval        time.Duration
-	stopGc            chan bool
+	defaultExpiration  time.Duration
+	items              map[string]Item
+	mu                 rwMutex
+	gcInterval         int64 // time.Duration, read by the GC loop whenever gcWake fires
+	gcWake             chan struct{}
+	stopGc             chan struct{}
+	stopOnce           sync.Once
+	closed             bool
+	frozen             bool
+	onEvicted          func(string, interface{})
+	onEvictedReason    func(string, interface{}, EvictReason)
+	onSizeChange       func(int)
+	sizeThresholds     []int
+	sizeLevel          int
+	evicted            []eviction
+	expiredQueue       []KeyItem
+	maxItems           int
+	evictionSampleSize int
+	evictionPolicy     EvictionPolicy
+	sketch             *cmSketch
+	maxKeyLength       int
+	subs               []*subscriber
+	published          []published
+	eventsMu           sync.Mutex
+	eventQueue         []*eventBatch
+	delivering         bool
+	bucketWidth        int64
+	buckets            map[int64]map[string]struct{}
+	values             map[interface{}]map[string]struct{}
+	version            uint64
+	dirty              map[string]struct{}
+	noLazyExpiry       bool
+	gobRegistered      bool
+	loads              loadGroup
+	loadSlots          chan struct{}
+	accesses           map[string]*uint64
+	owners             map[string]string
+	onKeyConflict      func(k, owner, caller string)
+	clockBase          time.Time
+	staleGrace         time.Duration
+	equals             func(a, b interface{}) bool
+	sizeFuncs          map[reflect.Type]func(interface{}) int64
+	logger             Logger
+	maxTags            int
+	maxKeysPerTag      int
+	deepCopy           func(interface{}) interface{}
+	validators         map[string]*validator
+	validated          int32 // set once SetWithValidator was called, so Get only checks validators then
+	reclaimExpired     bool
+	loadErrorTTL       time.Duration
+	maxValueBytes      int64
+	gcBudget           time.Duration
+	autoCompact        float64
+	peakItems          int
+	deleteOnExpiredGet bool
+	cow                bool
+	snapshot           atomic.Value // map[string]Item
+	snapshotStale      bool
+	evictQueue         chan eviction
+	evictMu            sync.RWMutex // guards evictQueue, which Close closes
+	evictWg            sync.WaitGroup
+	evictWorkers       int
+	expiredCh          chan KeyItem
+	tags               map[string]map[string]struct{}
+	keyTags            map[string][]string
+	memThreshold       uint64
+	memTarget          int64
+	serializer         Serializer
+	lastGCRun          int64
+	lastGCDuration     int64
+	count              int64 // len(items), kept for Count to read without the lock
+	gcErr              atomic.Value
+	callbackErr        atomic.Value
+	overflowPolicy     OverflowPolicy
+	overflowTimeout    time.Duration
+	stats              stats
+	tee                *tee
+	fallbacks          []*Cache
+	fallbackTTL        time.Duration
+	spillDir           string
+	spillThreshold     int
+	prespilled         *spilled // the value Set spilled before taking the lock, for store to use
+	spillDrops         []string // files of dropped values, removed by unlock
+	observer           func(op, k string, hit bool, d time.Duration)
+	gcGrowth           int
+	gcBaseline         int
+	gcTrigger          chan struct{}
+}
+
+// Stats is a snapshot of the cache counters.
+type Stats struct {
+	ExpiredDropped uint64 // Expiry notifications dropped by the overflow policy
+	Expired        uint64 // Expired items deleted by DeleteExpired
+	GCRuns         uint64 // Completed GC runs, by the GC loop or RunGC
+}
+
+type stats struct {
+	expiredDropped uint64
+	expired        uint64
+	gcRuns         uint64
 }
 
 // Expired returns true if the item has expired.
@@ -41,78 +175,771 @@ func (item Item) Expired() bool {
 
 // Globaly clean expired items.
 func (c *Cache) gcLoop() {
-	ticker := time.NewTicker(c.gcInterval)
+	interval := func() time.Duration {
+		return time.Duration(atomic.LoadInt64(&c.gcInterval))
+	}
+	runGCLoop(interval, c.RunGC, c.gcTrigger, c.gcWake, c.stopGc)
+}
+
+// runGCLoop calls gc every interval, and whenever trigger fires, until stop is closed.
+// When wake fires, it restarts the ticker with the current interval, and a non-positive one disables it.
+// It's shared by Cache and StringCache, which pass nil for the channels they don't use.
+func runGCLoop(interval func() time.Duration, gc func(), trigger, wake, stop <-chan struct{}) {
+	var ticker *time.Ticker
+	var tick <-chan time.Time
+	reset := func(d time.Duration) {
+		if ticker != nil {
+			ticker.Stop()
+			ticker, tick = nil, nil
+		}
+		if d > 0 {
+			ticker = time.NewTicker(d)
+			tick = ticker.C
+		}
+	}
+	reset(interval())
+	defer reset(0)
 	for {
 		select {
-		case <-ticker.C:
-			c.DeleteExpired()
-		case <-c.stopGc:
-			ticker.Stop()
+		case <-tick:
+			gc()
+		case <-trigger:
+			gc()
+		case <-wake:
+			reset(interval())
+		case <-stop:
 			return
 		}
 	}
 }
 
-func (c *Cache) del(k string) {
+// SetGCInterval changes the interval of the GC loop at runtime, restarting its ticker so the next run
+// happens d from now. A d of zero or less disables the periodic GC until it's set again.
+// It never blocks, so it may be called from eviction callbacks, which run on the GC loop during a GC,
+// and it has no effect once the GC loop is stopped.
+func (c *Cache) SetGCInterval(d time.Duration) {
+	atomic.StoreInt64(&c.gcInterval, int64(d))
+	select {
+	case c.gcWake <- struct{}{}:
+	default:
+	}
+}
+
+// RunGC synchronously does the work of one round of the GC loop: it deletes the expired items,
+// firing their eviction callbacks and expiry notifications, enforces WithMemoryPressureEviction
+// and updates LastGCRun and Stats. Panics are recovered and available from LastGCError.
+func (c *Cache) RunGC() {
+	defer func() {
+		if x := recover(); x != nil {
+			err := fmt.Errorf("GC panicked: %v", x)
+			c.gcErr.Store(storedError{err})
+			if c.logger != nil {
+				c.logger.Errorf("%v", err)
+			}
+		}
+	}()
+	c.DeleteExpired()
+	c.deleteInvalid()
+	if c.loadErrorTTL > 0 {
+		c.loads.deleteExpiredErrs(c.now())
+	}
+	if c.memThreshold > 0 {
+		c.checkMemoryPressure()
+	}
+	atomic.AddUint64(&c.stats.gcRuns, 1)
+}
+
+// storedError wraps errors kept in an atomic.Value, which requires a consistent concrete type.
+type storedError struct {
+	err error
+}
+
+// LastGCRun returns when DeleteExpired last completed, or the zero time if it never did.
+func (c *Cache) LastGCRun() time.Time {
+	if t := atomic.LoadInt64(&c.lastGCRun); t != 0 {
+		return time.Unix(0, t)
+	}
+	return time.Time{}
+}
+
+// LastGCDuration returns how long the last DeleteExpired held the write lock, or 0 if it never ran.
+func (c *Cache) LastGCDuration() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.lastGCDuration))
+}
+
+// LastGCError returns the error recovered from the last panic in the GC loop, if any.
+func (c *Cache) LastGCError() error {
+	if e, ok := c.gcErr.Load().(storedError); ok {
+		return e.err
+	}
+	return nil
+}
+
+// LastCallbackError returns the error recovered from the last panic in a user callback, such as OnEvicted, if any.
+func (c *Cache) LastCallbackError() error {
+	if e, ok := c.callbackErr.Load().(storedError); ok {
+		return e.err
+	}
+	return nil
+}
+
+// observe reports an operation started at start to the WithObserver function.
+// hit is read when observe runs, so it can be deferred before the outcome is known.
+func (c *Cache) observe(op, k string, start time.Time, hit *bool) {
+	d := time.Since(start)
+	c.safely(func() { c.observer(op, k, *hit, d) })
+}
+
+// safely calls the user callback f, recovering from a panic so it's available from LastCallbackError
+// instead of crashing the GC loop or an eviction worker.
+func (c *Cache) safely(f func()) {
+	defer func() {
+		if x := recover(); x != nil {
+			err := fmt.Errorf("Callback panicked: %v", x)
+			c.callbackErr.Store(storedError{err})
+			if c.logger != nil {
+				c.logger.Errorf("%v", err)
+			}
+		}
+	}()
+	f()
+}
+
+// del deletes the key k and queues its eviction callbacks, which are fired by unlock.
+func (c *Cache) del(k string, reason EvictReason) {
+	c.untag(k)
+	v, found := c.items[k]
+	if !found {
+		return
+	}
+	if c.onEvicted != nil || c.onEvictedReason != nil {
+		c.evicted = append(c.evicted, eviction{
+			k:      k,
+			v:      v.Object,
+			reason: reason,
+			f:      c.onEvicted,
+			fr:     c.onEvictedReason,
+		})
+	}
+	c.unindex(k, v)
+	c.markDirty(k)
 	delete(c.items, k)
+	atomic.StoreInt64(&c.count, int64(len(c.items)))
+	delete(c.accesses, k)
+	delete(c.owners, k)
+	delete(c.validators, k)
+	c.dropSpilled(v.Object, nil)
+	c.publish(EventDelete, k, v.Object)
+}
+
+// unlock releases the write lock, then delivers the events, fires the eviction callbacks
+// and sends the expiry notifications queued while it was held.
+// Their spilled values are read back once the lock is released and the dropped files removed afterwards.
+func (c *Cache) unlock() {
+	if c.autoCompact > 0 {
+		c.maybeCompact()
+	}
+	evicted, expired, drops := c.evicted, c.expiredQueue, c.spillDrops
+	c.evicted, c.expiredQueue, c.spillDrops = nil, nil, nil
+	onSizeChange, n := c.checkSize()
+	c.publishSnapshot()
+	batch := c.queueEvents()
+	c.mu.Unlock()
+	if batch != nil && batch.ready != nil {
+		batch.unspill()
+	}
+	c.deliverEvents()
+	for _, e := range evicted {
+		e.v, _ = unspill(e.v)
+		c.evict(e)
+	}
+	for _, ki := range expired {
+		ki.Item.Object, _ = unspill(ki.Item.Object)
+		c.notifyExpired(ki)
+	}
+	removeSpilled(drops)
+	if onSizeChange != nil {
+		c.safely(func() { onSizeChange(n) })
+	}
 }
 
 // DeleteExpired deletes the expired items.
+// It scans every item, so its cost grows with the cache size rather than with how often keys are overwritten:
+// rapidly overwriting a small set of keys adds nothing to it, since an overwritten item replaces the old one
+// instead of leaving it behind for the GC. Use WithExpirationBuckets to only visit the items that are due.
+// With WithGCBudget, it stops once it has held the lock for the budget and leaves the rest to the next run.
 func (c *Cache) DeleteExpired() {
-	now := time.Now().UnixNano()
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	if c.frozen {
+		c.mu.Unlock()
+		return
+	}
+	start := time.Now()
+	var deadline time.Time
+	if c.gcBudget > 0 {
+		deadline = start.Add(c.gcBudget)
+	}
+	n, complete := c.deleteExpired(deadline)
+	c.gcBaseline = len(c.items)
+	atomic.StoreInt64(&c.lastGCDuration, int64(time.Since(start)))
+	c.unlock()
+	if c.logger != nil && n > 0 {
+		c.logger.Debugf("GC deleted %d expired items", n)
+	}
+	if c.logger != nil && !complete {
+		c.logger.Debugf("GC ran out of its %v budget", c.gcBudget)
+	}
+	atomic.StoreInt64(&c.lastGCRun, time.Now().UnixNano())
+}
 
-	for k, v := range c.items {
-		if v.Expiration > 0 && now > v.Expiration {
-			c.del(k)
+// deleteExpired deletes the items expired for longer than the WithStaleGrace period, until deadline if it isn't zero,
+// and queues their expiry notifications, which are sent by unlock. It returns how many items it deleted
+// and whether it went through all of them. It must be called with the write lock held.
+func (c *Cache) deleteExpired(deadline time.Time) (n int, complete bool) {
+	now := c.now() - int64(c.staleGrace)
+	complete = c.forEachExpired(now, deadline, func(k string, v Item) {
+		if c.expiredCh != nil {
+			c.expiredQueue = append(c.expiredQueue, KeyItem{Key: k, Item: v})
+		}
+		c.del(k, EvictExpired)
+		n++
+	})
+	atomic.AddUint64(&c.stats.expired, uint64(n))
+	return n, complete
+}
+
+// EvictReason tells why an item was evicted.
+type EvictReason int
+
+const (
+	// EvictExpired is for items removed by the GC after expiring.
+	EvictExpired EvictReason = iota
+	// EvictCapacity is for items evicted to make room once the cache is full.
+	EvictCapacity
+	// EvictMemoryPressure is for items evicted because the process heap grew too large.
+	EvictMemoryPressure
+	// EvictDeleted is for items deleted explicitly, by Delete, InvalidateTag and the like.
+	EvictDeleted
+	// EvictFlushed is for items dropped by ReplaceAll.
+	EvictFlushed
+	// EvictInvalidated is for items deleted by the GC because their SetWithValidator validator rejected them.
+	EvictInvalidated
+)
+
+// eviction is an evicted item waiting for the eviction callbacks set when it was evicted.
+type eviction struct {
+	k      string
+	v      interface{}
+	reason EvictReason
+	f      func(string, interface{})
+	fr     func(string, interface{}, EvictReason)
+}
+
+func (e eviction) run() {
+	if e.f != nil {
+		e.f(e.k, e.v)
+	}
+	if e.fr != nil {
+		e.fr(e.k, e.v, e.reason)
+	}
+}
+
+// evict calls the eviction callbacks, on the worker pool if one is configured.
+func (c *Cache) evict(e eviction) {
+	c.evictMu.RLock()
+	if c.evictQueue != nil {
+		c.evictQueue <- e
+		c.evictMu.RUnlock()
+		return
+	}
+	c.evictMu.RUnlock()
+	c.safely(e.run)
+}
+
+func (c *Cache) evictLoop(queue chan eviction) {
+	defer c.evictWg.Done()
+	for e := range queue {
+		c.safely(e.run)
+	}
+}
+
+// stopEvictWorkers closes the eviction queue and waits for the workers to run the queued callbacks and exit.
+// Later evictions run their callbacks on the evicting goroutine.
+func (c *Cache) stopEvictWorkers() {
+	c.evictMu.Lock()
+	queue := c.evictQueue
+	c.evictQueue = nil
+	c.evictMu.Unlock()
+	if queue != nil {
+		close(queue)
+		c.evictWg.Wait()
+	}
+}
+
+// notifyExpired sends ki to the expired channel according to the overflow policy.
+func (c *Cache) notifyExpired(ki KeyItem) {
+	switch c.overflowPolicy {
+	case DropOldest:
+		select {
+		case c.expiredCh <- ki:
+			return
+		default:
+		}
+		// Make room only once, a concurrent sender may take it and an unbuffered channel has none to make
+		select {
+		case <-c.expiredCh:
+			atomic.AddUint64(&c.stats.expiredDropped, 1)
+		default:
+		}
+		select {
+		case c.expiredCh <- ki:
+		default:
+			atomic.AddUint64(&c.stats.expiredDropped, 1)
+		}
+	case Block:
+		if c.overflowTimeout <= 0 {
+			c.expiredCh <- ki
+			return
+		}
+		timer := time.NewTimer(c.overflowTimeout)
+		defer timer.Stop()
+		select {
+		case c.expiredCh <- ki:
+		case <-timer.C:
+			atomic.AddUint64(&c.stats.expiredDropped, 1)
+		}
+	default:
+		select {
+		case c.expiredCh <- ki:
+		default:
+			atomic.AddUint64(&c.stats.expiredDropped, 1)
 		}
 	}
 }
 
 // Set sets an item whether it exists.
+// It always fully replaces the item, so setting a key with NoExpiration clears any previous expiration.
+// Items rejected by WithMaxKeyLength or WithMaxValueBytes are silently ignored, use TrySet to get the error.
 func (c *Cache) Set(k string, v interface{}, d time.Duration) {
-	var e int64
-	if d == DefaultExpiration {
-		d = c.defaultExpiration
+	var stored bool
+	if c.observer != nil {
+		defer c.observe("Set", k, time.Now(), &stored)
 	}
-	if d > 0 {
-		e = time.Now().Add(d).UnixNano()
+	var caller, owner string
+	if c.owners != nil {
+		caller = callSite()
 	}
+	pre := c.prespill(v)
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.items[k] = Item{
-		Object:     v,
-		Expiration: e,
+	c.prespilled = pre
+	err := c.set(k, v, d)
+	if c.prespilled != nil {
+		// v was rejected before being stored
+		c.dropSpilled(c.prespilled, nil)
+		c.prespilled = nil
+	}
+	if err == nil && caller != "" {
+		owner = c.claim(k, caller)
+	}
+	c.unlock()
+	if owner != "" {
+		c.safely(func() { c.onKeyConflict(k, owner, caller) })
+	}
+	if stored = err == nil; stored {
+		c.mirror(func(other *Cache) { other.Set(k, v, d) })
 	}
 }
 
-func (c *Cache) set(k string, v interface{}, d time.Duration) {
+// TrySet is like Set but returns an error if the item is rejected.
+func (c *Cache) TrySet(k string, v interface{}, d time.Duration) error {
+	c.mu.Lock()
+	defer c.unlock()
+	return c.set(k, v, d)
+}
+
+// SetForever sets an item that never expires, like Set with NoExpiration.
+func (c *Cache) SetForever(k string, v interface{}) {
+	c.Set(k, v, NoExpiration)
+}
+
+// SetFor sets an item expiring after d, which must be positive: unlike with Set, a computed duration that happens
+// to be zero or negative is an error rather than meaning the default expiration or no expiration.
+// It returns the TrySet errors otherwise.
+func (c *Cache) SetFor(k string, v interface{}, d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("Invalid expiration %v for %s, it must be positive", d, k)
+	}
+	return c.TrySet(k, v, d)
+}
+
+// SetWithJitter is like Set but moves the expiration by a random duration in [-jitter, +jitter],
+// so items set together don't all expire together. Items that never expire aren't affected.
+func (c *Cache) SetWithJitter(k string, v interface{}, d, jitter time.Duration) {
+	if d == DefaultExpiration {
+		d = c.defaultExpiration
+	}
+	if d > 0 && jitter > 0 {
+		d += time.Duration(rand.Int63n(2*int64(jitter)+1)) - jitter
+		if d <= 0 {
+			d = 1
+		}
+	}
+	c.Set(k, v, d)
+}
+
+func (c *Cache) set(k string, v interface{}, d time.Duration) error {
+	if err := c.writable(); err != nil {
+		return err
+	}
+	if err := c.checkKey(k); err != nil {
+		return err
+	}
+	if err := c.checkValue(v); err != nil {
+		return err
+	}
 	var e int64
 	if d == DefaultExpiration {
 		d = c.defaultExpiration
 	}
+	now := c.now()
 	if d > 0 {
-		e = time.Now().Add(d).UnixNano()
+		e = now + int64(d)
+	}
+	c.untag(k)
+	delete(c.validators, k)
+	if c.sketch != nil {
+		c.sketch.increment(k)
 	}
-	c.items[k] = Item{
+	c.makeRoom(k)
+	c.version++
+	c.store(k, Item{
 		Object:     v,
 		Expiration: e,
+		Version:    c.version,
+		Created:    now,
+	})
+	c.publish(EventSet, k, v)
+	c.checkGrowth()
+	return nil
+}
+
+// checkGrowth wakes up the GC loop once the cache has grown by the WithGCOnGrowth threshold since the last GC.
+func (c *Cache) checkGrowth() {
+	if c.gcGrowth <= 0 || len(c.items)-c.gcBaseline < c.gcGrowth {
+		return
+	}
+	select {
+	case c.gcTrigger <- struct{}{}:
+	default:
 	}
 }
 
+// checkKey returns an error if the key k can't be stored.
+func (c *Cache) checkKey(k string) error {
+	if c.maxKeyLength > 0 && len(k) > c.maxKeyLength {
+		return ErrKeyTooLong
+	}
+	return nil
+}
+
+// checkValue returns ErrValueTooLarge if v is larger than the limit set by WithMaxValueBytes.
+func (c *Cache) checkValue(v interface{}) error {
+	if c.maxValueBytes <= 0 {
+		return nil
+	}
+	n, err := c.valueSize(v)
+	if err != nil {
+		return err
+	}
+	if n > c.maxValueBytes {
+		return ErrValueTooLarge
+	}
+	return nil
+}
+
 // Get returns the item and true if the key exists.
-func (c *Cache) Get(k string) (interface{}, bool) {
+// Unless disabled by WithLazyExpiry, items that have expired but haven't been collected yet are treated as missing.
+// With WithDeleteOnExpiredGet, expired items are deleted then.
+// With WithTeeFallback or WithFallbacks, misses are looked up in the lower layers.
+func (c *Cache) Get(k string) (v interface{}, found bool) {
+	if c.observer != nil {
+		defer c.observe("Get", k, time.Now(), &found)
+	}
+	v, found, expired := c.lookup(k)
+	if found && (atomic.LoadInt32(&c.validated) == 0 || c.valid(k)) {
+		return v, true
+	}
+	if expired && c.deleteOnExpiredGet {
+		c.deleteIfExpired(k)
+	}
+	return c.getFallback(k)
+}
+
+// deleteIfExpired deletes the item with key k if it's still expired, as the GC would.
+func (c *Cache) deleteIfExpired(k string) {
+	c.mu.Lock()
+	item, found := c.items[k]
+	// The item may have been set again since it was read
+	expired := found && c.writable() == nil && item.Expiration > 0 && c.now()-int64(c.staleGrace) > item.Expiration
+	if expired {
+		if c.expiredCh != nil {
+			c.expiredQueue = append(c.expiredQueue, KeyItem{Key: k, Item: item})
+		}
+		c.del(k, EvictExpired)
+		atomic.AddUint64(&c.stats.expired, 1)
+	}
+	c.unlock()
+}
+
+// lookup is Get without the tee fallback, it also returns whether the item was found expired.
+func (c *Cache) lookup(k string) (v interface{}, found, expired bool) {
+	var item Item
+	if c.lockFree() {
+		item, found = c.snapshot.Load().(map[string]Item)[k]
+	} else {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		item, found = c.items[k]
+	}
+	if !found {
+		return nil, false, false
+	}
+	if !c.noLazyExpiry && c.expired(item) {
+		return nil, false, true
+	}
+	if c.sketch != nil {
+		c.sketch.increment(k)
+	}
+	if c.accesses != nil {
+		c.accessed(k)
+	}
+	v, found = unspill(item.Object)
+	return v, found, false
+}
+
+// GetAndExtendIfBelow returns the value stored with key k and, only when its remaining TTL
+// has dropped below floor, extends its expiration to newTTL from now.
+// Reads only take the read lock, the write lock is taken just to extend.
+// Items that never expire are never extended.
+func (c *Cache) GetAndExtendIfBelow(k string, floor, newTTL time.Duration) (interface{}, bool) {
+	c.mu.RLock()
+	item, found := c.items[k]
+	if found && !c.expired(item) && (item.Expiration == 0 || c.ttl(item) >= floor) {
+		defer c.mu.RUnlock()
+		return unspill(item.Object)
+	}
+	c.mu.RUnlock()
+	if !found || c.expired(item) {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	// Check again since the item may have changed while no lock was held
+	item, found = c.items[k]
+	if !found || c.expired(item) {
+		return nil, false
+	}
+	if c.writable() == nil && item.Expiration > 0 && c.ttl(item) < floor {
+		item.Expiration = c.deadline(newTTL)
+		c.store(k, item)
+	}
+	return unspill(item.Object)
+}
+
+// GetItem returns a copy of the item stored with key k, including its expiration, and true if the key exists.
+func (c *Cache) GetItem(k string) (Item, bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	item, found := c.items[k]
+	if !found || c.expired(item) {
+		return Item{}, false
+	}
+	if item.Object, found = unspill(item.Object); !found {
+		return Item{}, false
+	}
+	return item, true
+}
+
+// GetWithMetadata returns the value stored with key k along with when it was created and when it expires.
+// Each time is zero when unknown, such as the creation of items loaded from old snapshots, or for items that never expire.
+func (c *Cache) GetWithMetadata(k string) (value interface{}, created, expires time.Time, ok bool) {
+	item, found := c.GetItem(k)
 	if !found {
-		return nil, false
+		return nil, time.Time{}, time.Time{}, false
+	}
+	if item.Created != 0 {
+		created = time.Unix(0, item.Created)
+	}
+	if item.Expiration != 0 {
+		expires = time.Unix(0, item.Expiration)
+	}
+	return item.Object, created, expires, true
+}
+
+// GetStale returns the value stored with key k even if it has expired.
+// fresh reports whether it's still within its TTL and found whether the key is in the cache at all.
+func (c *Cache) GetStale(k string) (value interface{}, fresh bool, found bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	item, found := c.items[k]
+	if !found {
+		return nil, false, false
+	}
+	if value, found = unspill(item.Object); !found {
+		return nil, false, false
+	}
+	return value, !c.expired(item), true
+}
+
+// SetError caches a negative result: err is stored as the item's value and returned by GetOrError.
+func (c *Cache) SetError(k string, err error, d time.Duration) {
+	c.Set(k, err, d)
+}
+
+// GetOrError returns the value stored with key k and true if the key exists.
+// If the stored value is an error, such as one cached by SetError, it's returned as the error instead of the value.
+func (c *Cache) GetOrError(k string) (interface{}, error, bool) {
+	v, found := c.Get(k)
+	if !found {
+		return nil, nil, false
+	}
+	if err, ok := v.(error); ok {
+		return nil, err, true
+	}
+	return v, nil, true
+}
+
+// GetManySplit returns the items found for keys and, in order and without duplicates, the keys that missed.
+func (c *Cache) GetManySplit(keys []string) (map[string]interface{}, []string) {
+	found := make(map[string]interface{}, len(keys))
+	var missing []string
+	seen := make(map[string]struct{}, len(keys))
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, k := range keys {
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+		if v, ok := c.get(k); ok {
+			found[k] = v
+		} else {
+			missing = append(missing, k)
+		}
+	}
+	return found, missing
+}
+
+// GetN returns up to n live items in no particular order, which makes it suitable for sampling.
+func (c *Cache) GetN(n int) map[string]interface{} {
+	items := make(map[string]interface{}, n)
+	if n <= 0 {
+		return items
+	}
+	now := c.now()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for k, v := range c.items {
+		if v.Expiration > 0 && now > v.Expiration {
+			continue
+		}
+		obj, ok := unspill(v.Object)
+		if !ok {
+			continue
+		}
+		items[k] = obj
+		if len(items) == n {
+			break
+		}
+	}
+	return items
+}
+
+// Sample returns a uniformly random subset of up to n live items, using reservoir sampling,
+// unlike GetN which returns the first ones in map iteration order.
+func (c *Cache) Sample(n int) map[string]interface{} {
+	if n <= 0 {
+		return map[string]interface{}{}
+	}
+	reservoir := make([]KeyItem, 0, n)
+	seen := 0
+	now := c.now()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for k, v := range c.items {
+		if v.Expiration > 0 && now > v.Expiration {
+			continue
+		}
+		seen++
+		if len(reservoir) < n {
+			reservoir = append(reservoir, KeyItem{Key: k, Item: v})
+		} else if i := rand.Intn(seen); i < n {
+			reservoir[i] = KeyItem{Key: k, Item: v}
+		}
+	}
+	items := make(map[string]interface{}, len(reservoir))
+	for _, ki := range reservoir {
+		if obj, ok := unspill(ki.Item.Object); ok {
+			items[ki.Key] = obj
+		}
 	}
-	if item.Expired() {
+	return items
+}
+
+// GetByPrefix returns all the live items whose key starts with prefix.
+// It scans every key, so it's O(n) in the cache size.
+func (c *Cache) GetByPrefix(prefix string) map[string]interface{} {
+	items := map[string]interface{}{}
+	now := c.now()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for k, v := range c.items {
+		if !strings.HasPrefix(k, prefix) || v.Expiration > 0 && now > v.Expiration {
+			continue
+		}
+		if obj, ok := unspill(v.Object); ok {
+			items[k] = obj
+		}
+	}
+	return items
+}
+
+// GetCopy is like Get but returns a shallow copy of []byte, slice and map values,
+// so the caller can mutate the result without affecting the cached value.
+// Other values are returned as-is.
+func (c *Cache) GetCopy(k string) (interface{}, bool) {
+	v, found := c.Get(k)
+	if !found {
 		return nil, false
 	}
-	return item.Object, true
+	return shallowCopy(v), true
+}
+
+func shallowCopy(v interface{}) interface{} {
+	if b, ok := v.([]byte); ok {
+		return append([]byte(nil), b...)
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice:
+		if rv.IsNil() {
+			return v
+		}
+		cp := reflect.MakeSlice(rv.Type(), rv.Len(), rv.Len())
+		reflect.Copy(cp, rv)
+		return cp.Interface()
+	case reflect.Map:
+		if rv.IsNil() {
+			return v
+		}
+		cp := reflect.MakeMapWithSize(rv.Type(), rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			cp.SetMapIndex(iter.Key(), iter.Value())
+		}
+		return cp.Interface()
+	}
+	return v
 }
 
 func (c *Cache) get(k string) (interface{}, bool) {
@@ -120,59 +947,467 @@ func (c *Cache) get(k string) (interface{}, bool) {
 	if !found {
 		return nil, false
 	}
-	if item.Expired() {
+	if c.expired(item) {
 		return nil, false
 	}
-	return item.Object, true
+	return unspill(item.Object)
 }
 
 // Add adds a new item to cache if it doesn't exist.
 func (c *Cache) Add(k string, v interface{}, d time.Duration) error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
+	if err := c.writable(); err != nil {
+		return err
+	}
 	_, found := c.get(k)
 	if found {
 		return fmt.Errorf("Item %s already exists", k)
 	}
-	c.set(k, v, d)
-	return nil
+	return c.set(k, v, d)
 }
 
 // Replace replaces the existed item with key k if it exists.
 func (c *Cache) Replace(k string, v interface{}, d time.Duration) error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
+	if err := c.writable(); err != nil {
+		return err
+	}
 	_, found := c.get(k)
 	if !found {
 		return fmt.Errorf("Item %s doesn't exist", k)
 	}
-	c.set(k, v, d)
-	return nil
+	return c.set(k, v, d)
+}
+
+// IncrementChecked adds n to the signed integer stored with key k and returns the result.
+// It returns an error and leaves the item unchanged if the result would overflow the value's type.
+func (c *Cache) IncrementChecked(k string, n int64) (int64, error) {
+	c.mu.Lock()
+	defer c.unlock()
+	if err := c.writable(); err != nil {
+		return 0, err
+	}
+	return c.increment(k, n)
+}
+
+// DecrementAndDeleteIfZero decrements the signed integer stored with key k and, if the result is zero or less,
+// deletes the key in the same step, firing the eviction callbacks with the decremented value, e.g. to release
+// reference-counted entries. It returns the result and whether the key was deleted, or an error if the key
+// is missing or its value isn't a signed integer.
+func (c *Cache) DecrementAndDeleteIfZero(k string) (int64, bool, error) {
+	c.mu.Lock()
+	defer c.unlock()
+	if err := c.writable(); err != nil {
+		return 0, false, err
+	}
+	n, err := c.increment(k, -1)
+	if err != nil || n > 0 {
+		return n, false, err
+	}
+	c.del(k, EvictDeleted)
+	return n, true, nil
+}
+
+// increment is IncrementChecked with the write lock held.
+func (c *Cache) increment(k string, n int64) (int64, error) {
+	item, found := c.items[k]
+	if !found || c.expired(item) {
+		return 0, fmt.Errorf("Item %s not found", k)
+	}
+	var cur, min, max int64
+	switch v := item.Object.(type) {
+	case int:
+		cur, min, max = int64(v), math.MinInt, math.MaxInt
+	case int8:
+		cur, min, max = int64(v), math.MinInt8, math.MaxInt8
+	case int16:
+		cur, min, max = int64(v), math.MinInt16, math.MaxInt16
+	case int32:
+		cur, min, max = int64(v), math.MinInt32, math.MaxInt32
+	case int64:
+		cur, min, max = v, math.MinInt64, math.MaxInt64
+	default:
+		return 0, fmt.Errorf("The value for %s is not a signed integer", k)
+	}
+	if (n > 0 && cur > max-n) || (n < 0 && cur < min-n) {
+		return 0, fmt.Errorf("Incrementing %s by %d overflows", k, n)
+	}
+	cur += n
+	c.version++
+	item.Version = c.version
+	switch item.Object.(type) {
+	case int:
+		item.Object = int(cur)
+	case int8:
+		item.Object = int8(cur)
+	case int16:
+		item.Object = int16(cur)
+	case int32:
+		item.Object = int32(cur)
+	case int64:
+		item.Object = cur
+	}
+	c.store(k, item)
+	c.publish(EventSet, k, item.Object)
+	return cur, nil
+}
+
+// SetKeepTTL replaces the value stored with key k but keeps its expiration, like Redis's SET KEEPTTL.
+// It returns whether the key existed, nothing is stored if it didn't or if v is rejected by WithMaxValueBytes.
+func (c *Cache) SetKeepTTL(k string, v interface{}) bool {
+	c.mu.Lock()
+	defer c.unlock()
+	if c.writable() != nil || c.checkValue(v) != nil {
+		return false
+	}
+	item, found := c.items[k]
+	if !found || c.expired(item) {
+		return false
+	}
+	c.version++
+	item.Object = v
+	item.Version = c.version
+	c.store(k, item)
+	c.publish(EventSet, k, v)
+	return true
+}
+
+// SetIfExpiringSoon sets an item only if the key is missing or expires in less than within,
+// and returns whether it was set, so concurrent refreshers only overwrite entries close to expiring.
+// Items that never expire are never overwritten.
+func (c *Cache) SetIfExpiringSoon(k string, v interface{}, d, within time.Duration) bool {
+	c.mu.Lock()
+	defer c.unlock()
+	if item, found := c.items[k]; found && !c.expired(item) {
+		if item.Expiration == 0 || c.ttl(item) >= within {
+			return false
+		}
+	}
+	return c.set(k, v, d) == nil
+}
+
+// Upsert sets an item whether it exists, it's the same as Set but named for intent.
+func (c *Cache) Upsert(k string, v interface{}, d time.Duration) {
+	c.Set(k, v, d)
+}
+
+// GetWithVersion returns the value stored with key k, its version and true if the key exists.
+// Versions come from a counter shared by the whole cache and increase on every set,
+// so a key never gets a version it had before, even after being deleted.
+func (c *Cache) GetWithVersion(k string) (interface{}, uint64, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	item, found := c.items[k]
+	if !found || c.expired(item) {
+		return nil, 0, false
+	}
+	v, found := unspill(item.Object)
+	if !found {
+		return nil, 0, false
+	}
+	return v, item.Version, true
+}
+
+// SetWithVersionCheck sets an item only if the current version of key k is expectedVersion,
+// 0 meaning that the key must not exist. It returns whether the item was set and its version afterwards.
+func (c *Cache) SetWithVersionCheck(k string, v interface{}, expectedVersion uint64, d time.Duration) (bool, uint64) {
+	c.mu.Lock()
+	defer c.unlock()
+	var version uint64
+	if item, found := c.items[k]; found && !c.expired(item) {
+		version = item.Version
+	}
+	if version != expectedVersion || c.set(k, v, d) != nil {
+		return false, version
+	}
+	return true, c.version
+}
+
+// AddOrReplace sets an item and returns true if it was created or false if it replaced an existing one.
+// It also returns false if the item is rejected.
+func (c *Cache) AddOrReplace(k string, v interface{}, d time.Duration) bool {
+	c.mu.Lock()
+	defer c.unlock()
+	_, found := c.get(k)
+	return c.set(k, v, d) == nil && !found
+}
+
+// ExpireNow makes the given keys expire immediately instead of deleting them,
+// so they go through the usual expiry path: Get treats them as missing and the GC collects them,
+// firing the eviction callbacks with EvictExpired. It returns how many of the keys were live.
+func (c *Cache) ExpireNow(keys ...string) int {
+	now := c.now()
+	c.mu.Lock()
+	defer c.unlock()
+	if c.writable() != nil {
+		return 0
+	}
+	n := 0
+	for _, k := range keys {
+		item, found := c.items[k]
+		if !found || c.expired(item) {
+			continue
+		}
+		item.Expiration = now - 1
+		c.store(k, item)
+		n++
+	}
+	return n
 }
 
 // Delete deletes the key k and its item.
 func (c *Cache) Delete(k string) {
+	var found bool
+	if c.observer != nil {
+		defer c.observe("Delete", k, time.Now(), &found)
+	}
 	c.mu.Lock()
-	c.del(k)
-	c.mu.Unlock()
+	err := c.writable()
+	if err == nil {
+		_, found = c.items[k]
+		c.del(k, EvictDeleted)
+	}
+	c.unlock()
+	if err == nil {
+		c.mirror(func(other *Cache) { other.Delete(k) })
+	}
+}
+
+// DeleteIfEqual deletes the key k only if its value equals expected and returns whether it was deleted.
+// Values are compared with the WithEquals function, by default with == when their type is comparable
+// and with reflect.DeepEqual otherwise.
+func (c *Cache) DeleteIfEqual(k string, expected interface{}) bool {
+	for {
+		version, ok := c.versionIfEqual(k, expected)
+		if !ok {
+			return false
+		}
+		c.mu.Lock()
+		if c.writable() != nil {
+			c.unlock()
+			return false
+		}
+		if item, found := c.items[k]; found && !c.expired(item) && item.Version == version {
+			c.del(k, EvictDeleted)
+			c.unlock()
+			return true
+		}
+		c.unlock()
+	}
 }
 
-// Save writes the cache to io.Writer.
-func (c *Cache) Save(w io.Writer) (err error) {
-	enc := gob.NewEncoder(w)
-	// Use recover() to catch registering error for interface{}
+// CompareAndSwap replaces the value of key k with new, keeping its expiration,
+// only if its current value equals old like for DeleteIfEqual, and returns whether it was replaced.
+// It also returns false if new is rejected by WithMaxValueBytes.
+func (c *Cache) CompareAndSwap(k string, old, new interface{}) bool {
+	if c.checkValue(new) != nil {
+		return false
+	}
+	for {
+		version, ok := c.versionIfEqual(k, old)
+		if !ok {
+			return false
+		}
+		c.mu.Lock()
+		if c.writable() != nil {
+			c.unlock()
+			return false
+		}
+		if item, found := c.items[k]; found && !c.expired(item) && item.Version == version {
+			c.version++
+			item.Object = new
+			item.Version = c.version
+			c.store(k, item)
+			c.publish(EventSet, k, new)
+			c.unlock()
+			return true
+		}
+		c.unlock()
+	}
+}
+
+// versionIfEqual returns the version of the live item with key k if its value equals expected.
+// The values are compared without holding the lock, since the WithEquals function is a callback,
+// so the caller must check the version is still the same once it holds the write lock, and compare again otherwise.
+func (c *Cache) versionIfEqual(k string, expected interface{}) (uint64, bool) {
+	c.mu.RLock()
+	item, found := c.items[k]
+	var v interface{}
+	if found && !c.expired(item) {
+		v, found = unspill(item.Object)
+	} else {
+		found = false
+	}
+	c.mu.RUnlock()
+	if !found || !c.equal(v, expected) {
+		return 0, false
+	}
+	return item.Version, true
+}
+
+// PopNearestExpiry deletes and returns the live item closest to expiring.
+// Items that never expire are never popped, ok is false when there is no such item.
+// It's O(n) in the number of items, or in the number of buckets with WithExpirationBuckets.
+func (c *Cache) PopNearestExpiry() (key string, value interface{}, ok bool) {
+	now := c.now()
+	c.mu.Lock()
+	defer c.unlock()
+	if c.writable() != nil {
+		return "", nil, false
+	}
+	k, found := c.nearestExpiry(now)
+	if !found {
+		return "", nil, false
+	}
+	v, _ := unspill(c.items[k].Object)
+	c.del(k, EvictDeleted)
+	return k, v, true
+}
+
+// equal compares a and b with the WithEquals function if any, and with the default equal otherwise.
+func (c *Cache) equal(a, b interface{}) bool {
+	if c.equals != nil {
+		return c.equals(a, b)
+	}
+	return equal(a, b)
+}
+
+// equal compares a and b with == if possible and with reflect.DeepEqual otherwise.
+func equal(a, b interface{}) (eq bool) {
+	t := reflect.TypeOf(a)
+	if t == nil || t != reflect.TypeOf(b) || !t.Comparable() {
+		return reflect.DeepEqual(a, b)
+	}
+	// Comparable types such as interfaces can still hold non-comparable values
 	defer func() {
 		if x := recover(); x != nil {
-			err = fmt.Errorf("Error registering item types with Gob library")
+			eq = reflect.DeepEqual(a, b)
 		}
 	}()
+	return a == b
+}
+
+// ReplaceAll atomically replaces all items with the given ones, each expiring after d.
+// Existing items that aren't in the new set are evicted.
+// Items rejected by WithMaxKeyLength or WithMaxValueBytes are left out,
+// and with WithMaxItems, only the first items in key order that fit are kept.
+func (c *Cache) ReplaceAll(items map[string]interface{}, d time.Duration) {
+	var e int64
+	if d == DefaultExpiration {
+		d = c.defaultExpiration
+	}
+	now := c.now()
+	if d > 0 {
+		e = now + int64(d)
+	}
+	m := make(map[string]Item, len(items))
+	for k, v := range items {
+		if c.checkKey(k) != nil || c.checkValue(v) != nil {
+			continue
+		}
+		m[k] = Item{
+			Object:     v,
+			Expiration: e,
+			Created:    now,
+		}
+	}
+	if c.maxItems > 0 && len(m) > c.maxItems {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys[c.maxItems:] {
+			delete(m, k)
+		}
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	if c.writable() != nil {
+		return
+	}
+	for k := range c.items {
+		if _, found := m[k]; !found {
+			c.del(k, EvictFlushed)
+		}
+	}
+	for k, v := range m {
+		if old, found := c.items[k]; found {
+			c.dropSpilled(old.Object, nil)
+		}
+		c.version++
+		v.Version = c.version
+		v.Object = c.spill(v.Object)
+		m[k] = v
+		c.markDirty(k)
+		c.track(k)
+	}
+	c.items = m
+	atomic.StoreInt64(&c.count, int64(len(c.items)))
+	c.tags, c.keyTags = nil, nil
+	c.validators = nil
+	c.resetIndexes()
+	for k, v := range m {
+		c.index(k, v)
+		c.publish(EventSet, k, v.Object)
+	}
+}
+
+// OnEvicted sets an optional function that is called with the key and value when an item is evicted from the cache,
+// including when it is deleted manually but not when it is overwritten. Set to nil to disable.
+// It's called after the cache lock is released, so it may use the cache.
+func (c *Cache) OnEvicted(f func(string, interface{})) {
+	c.mu.Lock()
+	defer c.unlock()
+	c.onEvicted = f
+}
+
+// OnEvictedWithReason is like OnEvicted but the function also gets why the item was evicted.
+// Both functions are called when both are set.
+func (c *Cache) OnEvictedWithReason(f func(string, interface{}, EvictReason)) {
+	c.mu.Lock()
+	defer c.unlock()
+	c.onEvictedReason = f
+}
+
+// OnSizeChange sets an optional function that is called with the item count whenever it crosses
+// one of the thresholds, up or down, checked after every write. Set f to nil to disable.
+// Like OnEvicted, it's called after the cache lock is released.
+func (c *Cache) OnSizeChange(thresholds []int, f func(count int)) {
+	c.mu.Lock()
+	defer c.unlock()
+	c.onSizeChange = f
+	c.sizeThresholds = append([]int(nil), thresholds...)
+	sort.Ints(c.sizeThresholds)
+	c.sizeLevel = c.level(len(c.items))
+}
+
+// checkSize returns the OnSizeChange function and the item count if the count crossed a threshold since the last check.
+func (c *Cache) checkSize() (func(int), int) {
+	if c.onSizeChange == nil {
+		return nil, 0
+	}
+	n := len(c.items)
+	level := c.level(n)
+	if level == c.sizeLevel {
+		return nil, 0
+	}
+	c.sizeLevel = level
+	return c.onSizeChange, n
+}
+
+// level returns how many size thresholds n reaches.
+func (c *Cache) level(n int) int {
+	return sort.SearchInts(c.sizeThresholds, n+1)
+}
+
+// Save writes the cache to io.Writer with the configured Serializer.
+func (c *Cache) Save(w io.Writer) error {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	for _, v := range c.items {
-		gob.Register(v.Object)
-	}
-	err = enc.Encode(&c.items)
-	return
+	return c.serializer.Encode(w, c.unspilledItems())
 }
 
 // SaveToFile saves the cache to a local file.
@@ -188,20 +1423,61 @@ func (c *Cache) SaveToFile(file string) error {
 	return f.Close()
 }
 
-// Load reads the cache from io.Reader.
+// Load reads the cache from io.Reader with the configured Serializer.
+// The decoded items are validated before any of them is merged into the cache,
+// and the items that have already expired or that Set would reject are skipped.
 func (c *Cache) Load(r io.Reader) error {
-	dec := gob.NewDecoder(r)
-	items := map[string]Item{}
-	err := dec.Decode(&items)
+	items, err := c.serializer.Decode(r)
 	if err != nil {
 		return err
 	}
+	if err = validateItems(items); err != nil {
+		return err
+	}
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
+	if err = c.writable(); err != nil {
+		return err
+	}
 	for k, v := range items {
-		ov, found := c.items[k]
-		if !found || ov.Expired() {
-			c.items[k] = v
+		c.load(k, v)
+	}
+	return nil
+}
+
+// load stores a loaded item unless it has expired or a live item with the same key exists.
+func (c *Cache) load(k string, v Item) {
+	if c.expired(v) {
+		return
+	}
+	ov, found := c.items[k]
+	if !found || c.expired(ov) {
+		c.put(k, v)
+	}
+}
+
+// put stores an item read from outside the cache, such as a snapshot, with a new version.
+// Items rejected by WithMaxKeyLength or WithMaxValueBytes are skipped, like Set would reject them.
+func (c *Cache) put(k string, v Item) {
+	if c.checkKey(k) != nil || c.checkValue(v.Object) != nil {
+		return
+	}
+	c.untag(k)
+	c.makeRoom(k)
+	c.version++
+	v.Version = c.version
+	c.store(k, v)
+	c.publish(EventSet, k, v.Object)
+}
+
+// validateItems checks decoded items before they are loaded.
+func validateItems(items map[string]Item) error {
+	if items == nil {
+		return fmt.Errorf("Decoded items are nil")
+	}
+	for k, v := range items {
+		if v.Expiration < 0 {
+			return fmt.Errorf("Item %s has invalid expiration %d", k, v.Expiration)
 		}
 	}
 	return nil
@@ -220,32 +1496,223 @@ func (c *Cache) LoadFromFile(file string) error {
 	return f.Close()
 }
 
-// Count returns the number of items.
+// ItemsByExpiration returns the live items sorted by expiration time, soonest first and never-expiring last.
+func (c *Cache) ItemsByExpiration() []KeyItem {
+	now := c.now()
+	c.mu.RLock()
+	items := make([]KeyItem, 0, len(c.items))
+	for k, v := range c.items {
+		if v.Expiration > 0 && now > v.Expiration {
+			continue
+		}
+		if obj, ok := unspill(v.Object); ok {
+			v.Object = obj
+			items = append(items, KeyItem{Key: k, Item: v})
+		}
+	}
+	c.mu.RUnlock()
+	sort.Slice(items, func(i, j int) bool {
+		return expiresBefore(items[i].Item.Expiration, items[j].Item.Expiration)
+	})
+	return items
+}
+
+// expiresBefore reports whether expiration a comes before b, where 0 means never.
+func expiresBefore(a, b int64) bool {
+	if a == 0 || b == 0 {
+		return b == 0 && a != 0
+	}
+	return a < b
+}
+
+// SaveToFileContext is like SaveToFile but returns ctx.Err() if ctx is done first.
+// The save then keeps running in the background and its result is discarded.
+func (c *Cache) SaveToFileContext(ctx context.Context, file string) error {
+	return withContext(ctx, func() error {
+		return c.SaveToFile(file)
+	})
+}
+
+// LoadFromFileContext is like LoadFromFile but returns ctx.Err() if ctx is done first.
+// The load then keeps running in the background and may still merge items into the cache.
+func (c *Cache) LoadFromFileContext(ctx context.Context, file string) error {
+	return withContext(ctx, func() error {
+		return c.LoadFromFile(file)
+	})
+}
+
+// withContext runs f on a goroutine and waits for it or for ctx to be done.
+func withContext(ctx context.Context, f func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- f()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Count returns the number of items, including the expired ones not collected yet.
+// It reads a counter kept up to date by the writers, so polling it doesn't contend for the lock.
 func (c *Cache) Count() int {
+	return int(atomic.LoadInt64(&c.count))
+}
+
+// CountByExpiry returns the number of live items that will expire and of those that never expire.
+func (c *Cache) CountByExpiry() (expiring int, permanent int) {
+	now := c.now()
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return len(c.items)
+	for _, v := range c.items {
+		switch {
+		case v.Expiration == 0:
+			permanent++
+		case now <= v.Expiration:
+			expiring++
+		}
+	}
+	return expiring, permanent
 }
 
 // Clear clears all items.
 func (c *Cache) Clear() {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
+	if c.writable() != nil {
+		return
+	}
+	c.clear()
+}
+
+// Drain removes all the items and returns the live ones in the same step, so no write lands between
+// reading the items and clearing the cache, e.g. to hand them off on shutdown. Like Clear, it doesn't fire
+// the eviction callbacks. It returns nil if the cache doesn't accept writes.
+func (c *Cache) Drain() map[string]Item {
+	c.mu.Lock()
+	defer c.unlock()
+	if c.writable() != nil {
+		return nil
+	}
+	items := make(map[string]Item, len(c.items))
+	for k, v := range c.items {
+		if c.expired(v) {
+			continue
+		}
+		if obj, ok := unspill(v.Object); ok {
+			v.Object = obj
+			items[k] = v
+		}
+	}
+	c.clear()
+	return items
+}
+
+// clear is Clear with the write lock held.
+func (c *Cache) clear() {
+	for k, v := range c.items {
+		c.markDirty(k)
+		c.dropSpilled(v.Object, nil)
+	}
 	c.items = map[string]Item{}
+	atomic.StoreInt64(&c.count, int64(len(c.items)))
+	c.tags, c.keyTags = nil, nil
+	c.resetIndexes()
+	if c.accesses != nil {
+		c.accesses = map[string]*uint64{}
+	}
+	if c.owners != nil {
+		c.owners = map[string]string{}
+	}
+	c.validators = nil
 }
 
-// StopGc stops gcLoop.
+// Stats returns a snapshot of the cache counters.
+func (c *Cache) Stats() Stats {
+	return Stats{
+		ExpiredDropped: atomic.LoadUint64(&c.stats.expiredDropped),
+		Expired:        atomic.LoadUint64(&c.stats.expired),
+		GCRuns:         atomic.LoadUint64(&c.stats.gcRuns),
+	}
+}
+
+// StopGc stops gcLoop by closing its stop channel, so it never blocks and calling it more than once,
+// even concurrently, has no effect.
 func (c *Cache) StopGc() {
-	c.stopGc <- true
+	c.stopOnce.Do(func() {
+		close(c.stopGc)
+	})
 }
 
-// NewCache creates a new cache and starts the gcLoop.
-func NewCache(defaultExpiration, gcInterval time.Duration) *Cache {
+// Close stops the GC loop and the eviction workers, once they've run the queued callbacks,
+// saves the cache to persistFile if one is given and closes the cache. With WithEvictionWorkers,
+// it must not be called from an eviction callback, which would wait for itself.
+// Afterwards writes returning an error fail with ErrClosed and the other ones are ignored,
+// while reads keep working. Closing a closed cache returns ErrClosed.
+func (c *Cache) Close(persistFile ...string) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	c.closed = true
+	c.mu.Unlock()
+	c.StopGc()
+	c.stopEvictWorkers()
+	if len(persistFile) > 0 {
+		return c.SaveToFile(persistFile[0])
+	}
+	return nil
+}
+
+// Freeze makes the cache read-only and stops the GC loop, so readers see a stable set of items.
+// Afterwards writes returning an error fail with ErrFrozen, the other ones are ignored,
+// and DeleteExpired does nothing, while Get keeps treating expired items as missing.
+func (c *Cache) Freeze() {
+	c.mu.Lock()
+	c.frozen = true
+	c.mu.Unlock()
+	c.StopGc()
+}
+
+// writable returns an error if the cache doesn't accept writes, it must be called with the write lock held.
+func (c *Cache) writable() error {
+	if c.closed {
+		return ErrClosed
+	}
+	if c.frozen {
+		return ErrFrozen
+	}
+	return nil
+}
+
+// NewCache creates a new cache and starts the gcLoop, which runs every gcInterval if it's positive.
+func NewCache(defaultExpiration, gcInterval time.Duration, opts ...Option) *Cache {
 	c := &Cache{
-		defaultExpiration: defaultExpiration,
-		gcInterval:        gcInterval,
-		items:             map[string]Item{},
-		stopGc:            make(chan bool),
+		defaultExpiration:  defaultExpiration,
+		gcInterval:         int64(gcInterval),
+		items:              map[string]Item{},
+		stopGc:             make(chan struct{}),
+		gcWake:             make(chan struct{}, 1),
+		serializer:         GobSerializer{},
+		evictionSampleSize: defaultEvictionSampleSize,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if s, ok := c.serializer.(GobSerializer); ok && c.gobRegistered {
+		s.Registered = true
+		c.serializer = s
+	}
+	if c.evictionPolicy == EvictLFU && c.maxItems > 0 {
+		c.sketch = newCMSketch(c.maxItems)
+	}
+	c.publishSnapshot()
+	for i := 0; i < c.evictWorkers; i++ {
+		c.evictWg.Add(1)
+		go c.evictLoop(c.evictQueue)
 	}
 	go c.gcLoop()
 	return c
@@ -1,7 +1,15 @@
 package gocache
 
 import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
 	"io/ioutil"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -140,3 +148,1063 @@ func TestFileSerialization(t *testing.T) {
 		t.Error("b is not b")
 	}
 }
+
+func TestIncrementChecked(t *testing.T) {
+	tc := NewCache(DefaultExpiration, 1*time.Millisecond)
+	defer tc.StopGc()
+	tc.Set("i8", int8(120), DefaultExpiration)
+	n, err := tc.IncrementChecked("i8", 7)
+	if err != nil || n != 127 {
+		t.Error("Incrementing i8 to its max failed:", n, err)
+	}
+	if _, err = tc.IncrementChecked("i8", 1); err == nil {
+		t.Error("Expected an overflow error for i8")
+	}
+	if x, _ := tc.Get("i8"); x.(int8) != 127 {
+		t.Error("i8 was changed by an overflowing increment:", x)
+	}
+
+	tc.Set("i64", int64(math.MinInt64+1), DefaultExpiration)
+	if _, err = tc.IncrementChecked("i64", -2); err == nil {
+		t.Error("Expected an underflow error for i64")
+	}
+	if n, err = tc.IncrementChecked("i64", math.MaxInt64); err != nil || n != 0 {
+		t.Error("Incrementing i64 back to 0 failed:", n, err)
+	}
+
+	tc.Set("s", "s", DefaultExpiration)
+	if _, err = tc.IncrementChecked("s", 1); err == nil {
+		t.Error("Expected an error incrementing a string")
+	}
+	if _, err = tc.IncrementChecked("missing", 1); err == nil {
+		t.Error("Expected an error incrementing a missing key")
+	}
+}
+
+func TestDecrementAndDeleteIfZero(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	var evicted []interface{}
+	tc.OnEvicted(func(k string, v interface{}) {
+		evicted = append(evicted, v)
+	})
+	tc.Set("refs", 2, DefaultExpiration)
+	if n, deleted, err := tc.DecrementAndDeleteIfZero("refs"); err != nil || n != 1 || deleted {
+		t.Error("Expected a decrement, got", n, deleted, err)
+	}
+	if n, deleted, err := tc.DecrementAndDeleteIfZero("refs"); err != nil || n != 0 || !deleted {
+		t.Error("Expected the key to be deleted at zero, got", n, deleted, err)
+	}
+	if _, found := tc.Get("refs"); found {
+		t.Error("Expected refs to be deleted")
+	}
+	if len(evicted) != 1 || evicted[0] != 0 {
+		t.Error("Expected the eviction callback with the final value, got", evicted)
+	}
+	if _, _, err := tc.DecrementAndDeleteIfZero("refs"); err == nil {
+		t.Error("Expected an error for a missing key")
+	}
+	tc.Set("s", "s", DefaultExpiration)
+	if _, _, err := tc.DecrementAndDeleteIfZero("s"); err == nil {
+		t.Error("Expected an error for a non-integer value")
+	}
+}
+
+func TestGetCopy(t *testing.T) {
+	tc := NewCache(DefaultExpiration, 1*time.Millisecond)
+	defer tc.StopGc()
+	tc.Set("b", []byte("abc"), DefaultExpiration)
+	tc.Set("s", []int{1, 2, 3}, DefaultExpiration)
+	tc.Set("m", map[string]int{"a": 1}, DefaultExpiration)
+
+	x, found := tc.GetCopy("b")
+	if !found {
+		t.Fatal("b was not found")
+	}
+	x.([]byte)[0] = 'x'
+	x, _ = tc.GetCopy("s")
+	x.([]int)[0] = 9
+	x, _ = tc.GetCopy("m")
+	x.(map[string]int)["a"] = 9
+
+	if b, _ := tc.Get("b"); string(b.([]byte)) != "abc" {
+		t.Error("Mutating the copy of b changed the cached value:", string(b.([]byte)))
+	}
+	if s, _ := tc.Get("s"); s.([]int)[0] != 1 {
+		t.Error("Mutating the copy of s changed the cached value:", s)
+	}
+	if m, _ := tc.Get("m"); m.(map[string]int)["a"] != 1 {
+		t.Error("Mutating the copy of m changed the cached value:", m)
+	}
+	if _, found = tc.GetCopy("missing"); found {
+		t.Error("Found a missing key")
+	}
+}
+
+func TestSerializationRoundTrip(t *testing.T) {
+	values := map[string]interface{}{
+		"int":     1,
+		"int64":   int64(2),
+		"uint8":   uint8(3),
+		"float64": 4.5,
+		"string":  "s",
+		"bool":    true,
+		"bytes":   []byte("b"),
+		"slice":   []string{"a", "b"},
+		"map":     map[string]int{"a": 1},
+		"struct":  &TestStruct{Num: 1, Children: []*TestStruct{{Num: 2}}},
+	}
+	tc := NewCache(DefaultExpiration, 1*time.Millisecond)
+	defer tc.StopGc()
+	for k, v := range values {
+		tc.Set(k, v, DefaultExpiration)
+	}
+	var buf bytes.Buffer
+	if err := tc.Save(&buf); err != nil {
+		t.Fatal("Couldn't save cache:", err)
+	}
+	oc := NewCache(DefaultExpiration, 1*time.Millisecond)
+	defer oc.StopGc()
+	if err := oc.Load(&buf); err != nil {
+		t.Fatal("Couldn't load cache:", err)
+	}
+	for k, v := range values {
+		x, found := oc.Get(k)
+		if !found {
+			t.Error(k, "was not found")
+		} else if !reflect.DeepEqual(x, v) {
+			t.Errorf("%s didn't round-trip: got %#v, want %#v", k, x, v)
+		}
+	}
+
+	tc.Set("fn", func() {}, DefaultExpiration)
+	err := tc.Save(&buf)
+	if err == nil {
+		t.Fatal("Expected an error saving a function")
+	}
+	if !strings.Contains(err.Error(), "item fn") {
+		t.Error("The error doesn't name the offending key:", err)
+	}
+}
+
+func TestLoadValidation(t *testing.T) {
+	var buf bytes.Buffer
+	items := map[string]Item{"a": {Object: "a", Expiration: -5}}
+	if err := gob.NewEncoder(&buf).Encode(&items); err != nil {
+		t.Fatal(err)
+	}
+	tc := NewCache(DefaultExpiration, 1*time.Millisecond)
+	defer tc.StopGc()
+	if err := tc.Load(&buf); err == nil {
+		t.Error("Expected an error loading an invalid expiration")
+	}
+	if tc.Count() != 0 {
+		t.Error("Invalid items were loaded")
+	}
+}
+
+func TestLoadSkipsExpired(t *testing.T) {
+	var buf bytes.Buffer
+	now := time.Now()
+	items := map[string]Item{
+		"fresh":   {Object: 1, Expiration: now.Add(time.Hour).UnixNano()},
+		"forever": {Object: 2},
+		"stale":   {Object: 3, Expiration: now.Add(-time.Hour).UnixNano()},
+	}
+	if err := gob.NewEncoder(&buf).Encode(&items); err != nil {
+		t.Fatal(err)
+	}
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	tc.Set("stale", 4, DefaultExpiration)
+	if err := tc.Load(&buf); err != nil {
+		t.Fatal("Couldn't load cache:", err)
+	}
+	if tc.Count() != 3 {
+		t.Error("Expected only the fresh items to be loaded, got", tc.Count())
+	}
+	if x, _ := tc.Get("stale"); x != 4 {
+		t.Error("Expected the stale item to be skipped, got", x)
+	}
+	if _, found := tc.Get("fresh"); !found {
+		t.Error("Expected the fresh item to be loaded")
+	}
+}
+
+func TestReplaceAll(t *testing.T) {
+	tc := NewCache(DefaultExpiration, 1*time.Millisecond)
+	defer tc.StopGc()
+	evicted := map[string]interface{}{}
+	tc.OnEvicted(func(k string, v interface{}) {
+		evicted[k] = v
+	})
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.ReplaceAll(map[string]interface{}{"b": 3, "c": 4}, DefaultExpiration)
+
+	if _, found := tc.Get("a"); found {
+		t.Error("Found a after it was replaced")
+	}
+	if x, _ := tc.Get("b"); x != 3 {
+		t.Error("b was not replaced:", x)
+	}
+	if x, _ := tc.Get("c"); x != 4 {
+		t.Error("c was not added:", x)
+	}
+	if len(evicted) != 1 || evicted["a"] != 1 {
+		t.Error("Expected only a to be evicted, got", evicted)
+	}
+}
+
+func TestGetManySplit(t *testing.T) {
+	tc := NewCache(DefaultExpiration, 1*time.Millisecond)
+	defer tc.StopGc()
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	found, missing := tc.GetManySplit([]string{"a", "c", "b", "c", "a", "d"})
+	if len(found) != 2 || found["a"] != 1 || found["b"] != 2 {
+		t.Error("Unexpected found items:", found)
+	}
+	if !reflect.DeepEqual(missing, []string{"c", "d"}) {
+		t.Error("Unexpected missing keys:", missing)
+	}
+}
+
+func TestAddOrReplace(t *testing.T) {
+	tc := NewCache(DefaultExpiration, 1*time.Millisecond)
+	defer tc.StopGc()
+	if !tc.AddOrReplace("a", 1, DefaultExpiration) {
+		t.Error("Expected a to be created")
+	}
+	if tc.AddOrReplace("a", 2, DefaultExpiration) {
+		t.Error("Expected a to be replaced")
+	}
+	if x, _ := tc.Get("a"); x != 2 {
+		t.Error("a was not replaced:", x)
+	}
+	tc.Upsert("b", 3, DefaultExpiration)
+	if x, _ := tc.Get("b"); x != 3 {
+		t.Error("b was not set:", x)
+	}
+}
+
+func TestDeleteIfEqual(t *testing.T) {
+	tc := NewCache(DefaultExpiration, 1*time.Millisecond)
+	defer tc.StopGc()
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("s", []int{1, 2}, DefaultExpiration)
+	if tc.DeleteIfEqual("a", 2) {
+		t.Error("Deleted a although its value differs")
+	}
+	if !tc.DeleteIfEqual("a", 1) {
+		t.Error("Didn't delete a although its value is equal")
+	}
+	if _, found := tc.Get("a"); found {
+		t.Error("Found a after it was deleted")
+	}
+	if !tc.DeleteIfEqual("s", []int{1, 2}) {
+		t.Error("Didn't delete s although its value is deeply equal")
+	}
+	if tc.DeleteIfEqual("missing", nil) {
+		t.Error("Deleted a missing key")
+	}
+}
+
+func TestGCHealth(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	if !tc.LastGCRun().IsZero() {
+		t.Error("Expected no GC run yet, got", tc.LastGCRun())
+	}
+	before := time.Now()
+	tc.DeleteExpired()
+	if tc.LastGCRun().Before(before) {
+		t.Error("LastGCRun wasn't updated:", tc.LastGCRun())
+	}
+
+	tc.OnEvicted(func(string, interface{}) {
+		panic("boom")
+	})
+	tc.Set("a", 1, time.Millisecond)
+	<-time.After(5 * time.Millisecond)
+	tc.RunGC()
+	if err := tc.LastCallbackError(); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Error("Expected the callback panic to be recorded, got", err)
+	}
+	if err := tc.LastGCError(); err != nil {
+		t.Error("Expected a callback panic not to reach the GC, got", err)
+	}
+}
+
+func TestGetStale(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	tc.Set("a", 1, time.Millisecond)
+	v, fresh, found := tc.GetStale("a")
+	if v != 1 || !fresh || !found {
+		t.Error("Expected a fresh a, got", v, fresh, found)
+	}
+	<-time.After(5 * time.Millisecond)
+	if _, found = tc.Get("a"); found {
+		t.Error("Get found the expired a")
+	}
+	v, fresh, found = tc.GetStale("a")
+	if v != 1 || fresh || !found {
+		t.Error("Expected a stale a, got", v, fresh, found)
+	}
+	if _, _, found = tc.GetStale("b"); found {
+		t.Error("Found a missing key")
+	}
+}
+
+func TestGetOrError(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	notFound := errors.New("not found")
+	tc.Set("a", 1, DefaultExpiration)
+	tc.SetError("b", notFound, DefaultExpiration)
+
+	v, err, found := tc.GetOrError("a")
+	if v != 1 || err != nil || !found {
+		t.Error("Expected the value of a, got", v, err, found)
+	}
+	v, err, found = tc.GetOrError("b")
+	if v != nil || err != notFound || !found {
+		t.Error("Expected the cached error of b, got", v, err, found)
+	}
+	if _, _, found = tc.GetOrError("c"); found {
+		t.Error("Found a missing key")
+	}
+}
+
+func TestItemsByExpiration(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	tc.Set("never", 0, NoExpiration)
+	tc.Set("later", 1, time.Hour)
+	tc.Set("expired", 2, time.Nanosecond)
+	tc.Set("sooner", 3, time.Minute)
+	<-time.After(time.Millisecond)
+	var keys []string
+	for _, ki := range tc.ItemsByExpiration() {
+		keys = append(keys, ki.Key)
+	}
+	if !reflect.DeepEqual(keys, []string{"sooner", "later", "never"}) {
+		t.Error("Unexpected order:", keys)
+	}
+}
+
+func TestGetN(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	for i := 0; i < 10; i++ {
+		tc.Set(strconv.Itoa(i), i, DefaultExpiration)
+	}
+	tc.Set("expired", -1, time.Nanosecond)
+	<-time.After(time.Millisecond)
+	if items := tc.GetN(3); len(items) != 3 {
+		t.Error("Expected 3 items, got", items)
+	}
+	items := tc.GetN(100)
+	if len(items) != 10 {
+		t.Error("Expected all 10 live items, got", items)
+	}
+	if _, found := items["expired"]; found {
+		t.Error("GetN returned an expired item")
+	}
+}
+
+func TestFileSerializationContext(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	tc.Set("a", "a", DefaultExpiration)
+	f, err := ioutil.TempFile("", "go-cache-cache.dat")
+	if err != nil {
+		t.Fatal("Couldn't create cache file:", err)
+	}
+	fname := f.Name()
+	f.Close()
+	if err = tc.SaveToFileContext(context.Background(), fname); err != nil {
+		t.Fatal("Couldn't save cache:", err)
+	}
+	oc := NewCache(DefaultExpiration, time.Hour)
+	defer oc.StopGc()
+	if err = oc.LoadFromFileContext(context.Background(), fname); err != nil {
+		t.Fatal("Couldn't load cache:", err)
+	}
+	if x, _ := oc.Get("a"); x != "a" {
+		t.Error("a didn't round-trip:", x)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tc.mu.Lock()
+	err = tc.SaveToFileContext(ctx, fname)
+	tc.mu.Unlock()
+	if err != context.Canceled {
+		t.Error("Expected a stuck save to return context.Canceled, got", err)
+	}
+}
+
+func TestCountByExpiry(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	tc.Set("a", 1, NoExpiration)
+	tc.Set("b", 2, time.Hour)
+	tc.Set("c", 3, time.Hour)
+	tc.Set("expired", 4, time.Nanosecond)
+	<-time.After(time.Millisecond)
+	if expiring, permanent := tc.CountByExpiry(); expiring != 2 || permanent != 1 {
+		t.Error("Expected 2 expiring and 1 permanent items, got", expiring, permanent)
+	}
+}
+
+func TestSetNoExpirationAfterTTL(t *testing.T) {
+	tc := NewCache(50*time.Millisecond, 1*time.Millisecond)
+	defer tc.StopGc()
+	tc.Set("a", 1, 10*time.Millisecond)
+	tc.Set("a", 2, NoExpiration)
+	tc.Set("b", 1, DefaultExpiration)
+	tc.Set("b", 2, NoExpiration)
+	tc.mu.RLock()
+	if e := tc.items["a"].Expiration; e != 0 {
+		t.Error("Expected a to have no expiration, got", e)
+	}
+	if e := tc.items["b"].Expiration; e != 0 {
+		t.Error("Expected b to have no expiration, got", e)
+	}
+	tc.mu.RUnlock()
+	<-time.After(70 * time.Millisecond)
+	if x, found := tc.Get("a"); !found || x != 2 {
+		t.Error("a expired although it was re-set with NoExpiration")
+	}
+	if x, found := tc.Get("b"); !found || x != 2 {
+		t.Error("b expired although it was re-set with NoExpiration")
+	}
+}
+
+func TestGetAndExtendIfBelow(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	tc.Set("a", 1, time.Hour)
+	tc.Set("b", 2, 10*time.Millisecond)
+	exp := tc.items["a"].Expiration
+	if x, found := tc.GetAndExtendIfBelow("a", time.Minute, 2*time.Hour); !found || x != 1 {
+		t.Error("Expected to get a, got", x, found)
+	}
+	if tc.items["a"].Expiration != exp {
+		t.Error("a was extended although its TTL is above the floor")
+	}
+	if x, found := tc.GetAndExtendIfBelow("b", time.Minute, time.Hour); !found || x != 2 {
+		t.Error("Expected to get b, got", x, found)
+	}
+	<-time.After(20 * time.Millisecond)
+	if _, found := tc.Get("b"); !found {
+		t.Error("b wasn't extended although its TTL was below the floor")
+	}
+	if _, found := tc.GetAndExtendIfBelow("c", time.Minute, time.Hour); found {
+		t.Error("Found a missing key")
+	}
+}
+
+func TestVersionCheck(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	ok, v1 := tc.SetWithVersionCheck("a", 1, 0, DefaultExpiration)
+	if !ok || v1 == 0 {
+		t.Fatal("Expected a to be created, got", ok, v1)
+	}
+	if ok, _ = tc.SetWithVersionCheck("a", 2, 0, DefaultExpiration); ok {
+		t.Error("Created a although it exists")
+	}
+	x, v, found := tc.GetWithVersion("a")
+	if !found || x != 1 || v != v1 {
+		t.Error("Unexpected a:", x, v, found)
+	}
+	ok, v2 := tc.SetWithVersionCheck("a", 2, v1, DefaultExpiration)
+	if !ok || v2 <= v1 {
+		t.Error("Expected a to be updated to a newer version, got", ok, v2)
+	}
+	if ok, v = tc.SetWithVersionCheck("a", 3, v1, DefaultExpiration); ok || v != v2 {
+		t.Error("Updated a with a stale version, got", ok, v)
+	}
+	tc.Set("a", 4, DefaultExpiration)
+	if _, v, _ = tc.GetWithVersion("a"); v <= v2 {
+		t.Error("Set didn't bump the version of a:", v)
+	}
+	tc.Delete("a")
+	tc.Set("a", 5, DefaultExpiration)
+	if _, v, _ = tc.GetWithVersion("a"); v <= v2 {
+		t.Error("Re-creating a reused an old version:", v)
+	}
+}
+
+func TestClose(t *testing.T) {
+	tc := NewCache(DefaultExpiration, 1*time.Millisecond)
+	defer tc.StopGc()
+	tc.Set("a", 1, DefaultExpiration)
+	f, err := ioutil.TempFile("", "go-cache-cache.dat")
+	if err != nil {
+		t.Fatal("Couldn't create cache file:", err)
+	}
+	fname := f.Name()
+	f.Close()
+	if err = tc.Close(fname); err != nil {
+		t.Fatal("Couldn't close cache:", err)
+	}
+	if err = tc.Close(); err != ErrClosed {
+		t.Error("Expected closing again to return ErrClosed, got", err)
+	}
+	tc.StopGc()
+
+	if err = tc.Add("b", 2, DefaultExpiration); err != ErrClosed {
+		t.Error("Expected Add to return ErrClosed, got", err)
+	}
+	if err = tc.TrySet("b", 2, DefaultExpiration); err != ErrClosed {
+		t.Error("Expected TrySet to return ErrClosed, got", err)
+	}
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Delete("a")
+	tc.Clear()
+	if x, found := tc.Get("a"); !found || x != 1 {
+		t.Error("The closed cache was mutated or can't be read:", x, found)
+	}
+	if _, found := tc.Get("b"); found {
+		t.Error("Set wrote to the closed cache")
+	}
+
+	oc := NewCache(DefaultExpiration, 1*time.Millisecond)
+	defer oc.StopGc()
+	if err = oc.LoadFromFile(fname); err != nil {
+		t.Fatal("Couldn't load the file saved by Close:", err)
+	}
+	if x, _ := oc.Get("a"); x != 1 {
+		t.Error("a wasn't saved by Close:", x)
+	}
+}
+
+func TestGetItem(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	before := time.Now()
+	tc.Set("a", 1, time.Hour)
+	item, found := tc.GetItem("a")
+	if !found || item.Object != 1 {
+		t.Error("Expected to get a, got", item, found)
+	}
+	if exp := time.Unix(0, item.Expiration); exp.Before(before.Add(time.Hour)) || exp.After(time.Now().Add(time.Hour)) {
+		t.Error("Unexpected expiration of a:", exp)
+	}
+	tc.Set("expired", 2, time.Nanosecond)
+	<-time.After(time.Millisecond)
+	if _, found = tc.GetItem("expired"); found {
+		t.Error("Found an expired item")
+	}
+}
+
+func TestSetKeepTTL(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	tc.Set("a", 1, time.Hour)
+	exp := tc.items["a"].Expiration
+	if !tc.SetKeepTTL("a", 2) {
+		t.Error("Expected a to exist")
+	}
+	item, _ := tc.GetItem("a")
+	if item.Object != 2 || item.Expiration != exp {
+		t.Error("Expected only the value of a to change, got", item)
+	}
+	if tc.SetKeepTTL("b", 1) {
+		t.Error("Expected b not to exist")
+	}
+	if _, found := tc.Get("b"); found {
+		t.Error("SetKeepTTL created b")
+	}
+}
+
+func TestStopGcConcurrently(t *testing.T) {
+	tc := NewCache(DefaultExpiration, 1*time.Millisecond)
+	defer tc.StopGc()
+	done := make(chan struct{})
+	for i := 0; i < 10; i++ {
+		go func() {
+			tc.StopGc()
+			done <- struct{}{}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("StopGc hung")
+		}
+	}
+	tc.StopGc()
+}
+
+func TestEvictReasons(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour, WithMaxItems(2))
+	defer tc.StopGc()
+	reasons := map[string]EvictReason{}
+	var plain []string
+	tc.OnEvicted(func(k string, v interface{}) {
+		plain = append(plain, k)
+	})
+	tc.OnEvictedWithReason(func(k string, v interface{}, reason EvictReason) {
+		reasons[k] = reason
+	})
+	tc.Set("expired", 1, time.Nanosecond)
+	<-time.After(time.Millisecond)
+	tc.DeleteExpired()
+	tc.Set("deleted", 2, DefaultExpiration)
+	tc.Set("capacity", 3, time.Hour)
+	tc.Delete("deleted")
+	tc.Set("flushed", 4, DefaultExpiration)
+	tc.Set("new", 5, DefaultExpiration)
+	tc.ReplaceAll(map[string]interface{}{"new": 6}, DefaultExpiration)
+
+	want := map[string]EvictReason{
+		"expired":  EvictExpired,
+		"deleted":  EvictDeleted,
+		"capacity": EvictCapacity,
+		"flushed":  EvictFlushed,
+	}
+	if !reflect.DeepEqual(reasons, want) {
+		t.Error("Unexpected eviction reasons:", reasons)
+	}
+	if len(plain) != len(want) {
+		t.Error("Expected the simple callback to be called too, got", plain)
+	}
+}
+
+func TestSetForeverAndSetFor(t *testing.T) {
+	tc := NewCache(time.Minute, time.Hour)
+	defer tc.StopGc()
+	tc.SetForever("a", 1)
+	if item, _ := tc.GetItem("a"); item.Expiration != 0 {
+		t.Error("Expected SetForever to never expire, got", item.Expiration)
+	}
+	if err := tc.SetFor("b", 2, time.Hour); err != nil {
+		t.Error("SetFor failed:", err)
+	}
+	if item, _ := tc.GetItem("b"); time.Until(time.Unix(0, item.Expiration)) < 50*time.Minute {
+		t.Error("Expected b to expire in an hour, got", item.Expiration)
+	}
+	for _, d := range []time.Duration{0, NoExpiration} {
+		if err := tc.SetFor("c", 3, d); err == nil {
+			t.Error("Expected an error for the expiration", d)
+		}
+	}
+	if _, found := tc.Get("c"); found {
+		t.Error("Expected c not to be set")
+	}
+}
+
+func TestSetWithJitter(t *testing.T) {
+	tc := NewCache(time.Hour, time.Hour)
+	defer tc.StopGc()
+	spread := map[int64]bool{}
+	for i := 0; i < 20; i++ {
+		start := time.Now()
+		tc.SetWithJitter("a", i, DefaultExpiration, time.Minute)
+		item, _ := tc.GetItem("a")
+		d := time.Duration(item.Expiration - start.UnixNano())
+		if d < 59*time.Minute || d > 61*time.Minute+time.Second {
+			t.Error("Expected the expiration to be within the jitter, got", d)
+		}
+		spread[item.Expiration-start.UnixNano()] = true
+	}
+	if len(spread) < 2 {
+		t.Error("Expected expirations to be spread")
+	}
+
+	tc.SetWithJitter("b", 1, NoExpiration, time.Minute)
+	if item, _ := tc.GetItem("b"); item.Expiration != 0 {
+		t.Error("Expected items without expiration to be left alone")
+	}
+	tc.SetWithJitter("c", 1, time.Nanosecond, time.Hour)
+	if tc.items["c"].Expiration == 0 {
+		t.Error("Expected a jitter larger than the TTL not to disable expiration")
+	}
+}
+
+func TestPopNearestExpiry(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithExpirationBuckets(time.Minute)}} {
+		tc := NewCache(DefaultExpiration, time.Hour, opts...)
+		defer tc.StopGc()
+		tc.Set("forever", 0, NoExpiration)
+		tc.Set("expired", 0, time.Nanosecond)
+		tc.Set("c", 3, 3*time.Hour)
+		tc.Set("a", 1, time.Second)
+		tc.Set("b", 2, 2*time.Minute)
+		<-time.After(time.Millisecond)
+
+		for _, want := range []string{"a", "b", "c"} {
+			k, _, ok := tc.PopNearestExpiry()
+			if !ok || k != want {
+				t.Errorf("Expected to pop %s, got %s", want, k)
+			}
+			if _, found := tc.Get(want); found {
+				t.Errorf("Expected %s to be deleted", want)
+			}
+		}
+		if k, _, ok := tc.PopNearestExpiry(); ok {
+			t.Error("Expected nothing left to pop, got", k)
+		}
+		if _, found := tc.Get("forever"); !found {
+			t.Error("Expected items without expiration to be kept")
+		}
+	}
+}
+
+func TestGetByPrefix(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	tc.Set("user:1", 1, DefaultExpiration)
+	tc.Set("user:2", 2, DefaultExpiration)
+	tc.Set("user:3", 3, time.Nanosecond)
+	tc.Set("group:1", 4, DefaultExpiration)
+	<-time.After(time.Millisecond)
+
+	items := tc.GetByPrefix("user:")
+	if !reflect.DeepEqual(items, map[string]interface{}{"user:1": 1, "user:2": 2}) {
+		t.Error("Unexpected items:", items)
+	}
+	if items := tc.GetByPrefix("none:"); len(items) != 0 {
+		t.Error("Expected no items, got", items)
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Millisecond)
+	defer tc.StopGc()
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, time.Nanosecond)
+	tc.Freeze()
+
+	if err := tc.Add("c", 3, DefaultExpiration); err != ErrFrozen {
+		t.Error("Expected Add to return ErrFrozen, got", err)
+	}
+	if err := tc.TrySet("c", 3, DefaultExpiration); err != ErrFrozen {
+		t.Error("Expected TrySet to return ErrFrozen, got", err)
+	}
+	if tc.DeleteIfEqual("a", 1) {
+		t.Error("Expected DeleteIfEqual to fail")
+	}
+	tc.Set("a", 2, DefaultExpiration)
+	tc.Delete("a")
+	tc.Clear()
+	if x, found := tc.Get("a"); !found || x != 1 {
+		t.Error("The frozen cache was mutated:", x, found)
+	}
+
+	<-time.After(5 * time.Millisecond)
+	tc.DeleteExpired()
+	if _, found := tc.Get("b"); found {
+		t.Error("Expected the expired item to be treated as missing")
+	}
+	if n := tc.Count(); n != 2 {
+		t.Error("Expected the frozen cache to keep its expired items, got", n)
+	}
+}
+
+func TestOnSizeChange(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	var counts []int
+	tc.OnSizeChange([]int{3, 2}, func(n int) {
+		counts = append(counts, n)
+	})
+	for _, k := range []string{"a", "b", "c", "d"} {
+		tc.Set(k, 1, DefaultExpiration)
+	}
+	tc.Set("a", 2, DefaultExpiration)
+	tc.Delete("d")
+	tc.Delete("c")
+	tc.Clear()
+	if !reflect.DeepEqual(counts, []int{2, 3, 2, 0}) {
+		t.Error("Unexpected size changes:", counts)
+	}
+}
+
+func TestSample(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	for i := 0; i < 10; i++ {
+		tc.Set(strconv.Itoa(i), i, DefaultExpiration)
+	}
+	tc.Set("expired", -1, time.Nanosecond)
+	<-time.After(time.Millisecond)
+
+	hits := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		items := tc.Sample(3)
+		if len(items) != 3 {
+			t.Fatal("Expected 3 items, got", len(items))
+		}
+		for k := range items {
+			hits[k]++
+		}
+	}
+	if hits["expired"] != 0 {
+		t.Error("Expected expired items not to be sampled")
+	}
+	// Each key is expected 300 times.
+	for i := 0; i < 10; i++ {
+		if n := hits[strconv.Itoa(i)]; n < 200 || n > 400 {
+			t.Errorf("Key %d was sampled %d times", i, n)
+		}
+	}
+	if items := tc.Sample(20); len(items) != 10 {
+		t.Error("Expected all the live items, got", len(items))
+	}
+}
+
+func TestCallbackPanic(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	if err := tc.LastCallbackError(); err != nil {
+		t.Error("Expected no callback error, got", err)
+	}
+	tc.OnEvicted(func(string, interface{}) {
+		panic("boom")
+	})
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Delete("a")
+	if err := tc.LastCallbackError(); err == nil {
+		t.Error("Expected the panic to be recorded")
+	}
+	// The lock must have been released.
+	tc.Set("b", 2, DefaultExpiration)
+	if _, found := tc.Get("b"); !found {
+		t.Error("Expected the cache to keep working")
+	}
+}
+
+func TestGetWithMetadata(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	before := time.Now()
+	tc.Set("a", 1, time.Hour)
+	tc.Set("b", 2, NoExpiration)
+
+	v, created, expires, ok := tc.GetWithMetadata("a")
+	if !ok || v != 1 {
+		t.Fatal("Expected a to be found, got", v)
+	}
+	if created.Before(before) || created.After(time.Now()) {
+		t.Error("Unexpected creation time:", created)
+	}
+	if !expires.Equal(created.Add(time.Hour)) {
+		t.Error("Unexpected expiration time:", expires)
+	}
+	if _, _, expires, _ = tc.GetWithMetadata("b"); !expires.IsZero() {
+		t.Error("Expected no expiration time, got", expires)
+	}
+	if _, _, _, ok = tc.GetWithMetadata("c"); ok {
+		t.Error("Expected c not to be found")
+	}
+
+	tc.SetKeepTTL("a", 3)
+	if _, c, _, _ := tc.GetWithMetadata("a"); !c.Equal(created) {
+		t.Error("Expected SetKeepTTL to keep the creation time")
+	}
+}
+
+func TestExpireNow(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithExpirationBuckets(time.Minute)}} {
+		tc := NewCache(DefaultExpiration, time.Hour, opts...)
+		defer tc.StopGc()
+		var reasons []EvictReason
+		tc.OnEvictedWithReason(func(k string, v interface{}, reason EvictReason) {
+			reasons = append(reasons, reason)
+		})
+		tc.Set("a", 1, NoExpiration)
+		tc.Set("b", 2, time.Hour)
+		tc.Set("c", 3, time.Hour)
+		if n := tc.ExpireNow("a", "b", "missing"); n != 2 {
+			t.Error("Expected 2 keys to be expired, got", n)
+		}
+		if _, found := tc.Get("a"); found {
+			t.Error("Expected a to be expired")
+		}
+		if tc.Count() != 3 {
+			t.Error("Expected the expired items to be kept until the GC")
+		}
+		tc.DeleteExpired()
+		if tc.Count() != 1 || !reflect.DeepEqual(reasons, []EvictReason{EvictExpired, EvictExpired}) {
+			t.Error("Expected the GC to collect the expired items, got", tc.Count(), reasons)
+		}
+	}
+}
+
+func TestRunGC(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	var evicted []string
+	tc.OnEvicted(func(k string, v interface{}) {
+		evicted = append(evicted, k)
+	})
+	tc.Set("a", 1, time.Nanosecond)
+	tc.Set("b", 2, NoExpiration)
+	<-time.After(time.Millisecond)
+	before := time.Now()
+	tc.RunGC()
+	if !reflect.DeepEqual(evicted, []string{"a"}) {
+		t.Error("Expected a to be collected, got", evicted)
+	}
+	if tc.LastGCRun().Before(before) {
+		t.Error("LastGCRun wasn't updated:", tc.LastGCRun())
+	}
+	if s := tc.Stats(); s.Expired != 1 || s.GCRuns != 1 {
+		t.Error("Unexpected stats:", s)
+	}
+}
+
+func TestSetIfExpiringSoon(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	if !tc.SetIfExpiringSoon("a", 1, time.Hour, time.Minute) {
+		t.Error("Expected a missing key to be set")
+	}
+	if tc.SetIfExpiringSoon("a", 2, time.Hour, time.Minute) {
+		t.Error("Expected a key with plenty of TTL left not to be set")
+	}
+	tc.Set("b", 1, 30*time.Second)
+	if !tc.SetIfExpiringSoon("b", 2, time.Hour, time.Minute) {
+		t.Error("Expected a key expiring soon to be set")
+	}
+	if x, _ := tc.Get("b"); x != 2 {
+		t.Error("b wasn't refreshed:", x)
+	}
+	tc.Set("c", 1, NoExpiration)
+	if tc.SetIfExpiringSoon("c", 2, time.Hour, time.Minute) {
+		t.Error("Expected a key that never expires not to be set")
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	tc.Set("a", []int{1}, time.Hour)
+	before, _ := tc.GetItem("a")
+	if tc.CompareAndSwap("a", []int{2}, []int{3}) {
+		t.Error("Expected a mismatch not to swap")
+	}
+	if !tc.CompareAndSwap("a", []int{1}, []int{3}) {
+		t.Error("Expected a match to swap")
+	}
+	after, _ := tc.GetItem("a")
+	if !reflect.DeepEqual(after.Object, []int{3}) || after.Expiration != before.Expiration {
+		t.Error("Expected the value to be swapped keeping the expiration, got", after)
+	}
+	if tc.CompareAndSwap("missing", nil, 1) {
+		t.Error("Expected a missing key not to swap")
+	}
+}
+
+func TestCount(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour, WithMaxItems(3))
+	defer tc.StopGc()
+	check := func(what string) {
+		t.Helper()
+		tc.mu.RLock()
+		n := len(tc.items)
+		tc.mu.RUnlock()
+		if tc.Count() != n {
+			t.Error("Count out of sync after", what, tc.Count(), n)
+		}
+	}
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("a", 2, DefaultExpiration)
+	tc.Set("b", 3, time.Nanosecond)
+	check("set")
+	tc.Set("c", 4, DefaultExpiration)
+	tc.Set("d", 5, DefaultExpiration)
+	check("eviction")
+	tc.Delete("c")
+	tc.Delete("missing")
+	check("delete")
+	tc.Set("e", 6, time.Nanosecond)
+	<-time.After(time.Millisecond)
+	tc.DeleteExpired()
+	check("GC")
+	tc.ReplaceAll(map[string]interface{}{"x": 1, "y": 2}, DefaultExpiration)
+	check("ReplaceAll")
+	tc.Clear()
+	check("Clear")
+	if tc.Count() != 0 {
+		t.Error("Expected an empty cache, got", tc.Count())
+	}
+}
+
+func TestSetGCInterval(t *testing.T) {
+	tc := NewCache(DefaultExpiration, 0)
+	defer tc.StopGc()
+	<-time.After(20 * time.Millisecond)
+	if n := tc.Stats().GCRuns; n != 0 {
+		t.Error("Expected a zero interval to disable the GC, got runs:", n)
+	}
+	tc.SetGCInterval(5 * time.Millisecond)
+	deadline := time.Now().Add(time.Second)
+	for tc.Stats().GCRuns < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the GC to run at the new interval, got runs:", tc.Stats().GCRuns)
+		}
+		<-time.After(time.Millisecond)
+	}
+	tc.SetGCInterval(time.Hour)
+	// Once the loop took the wake-up, any run it was doing is over and the next is an hour away
+	deadline = time.Now().Add(time.Second)
+	for len(tc.gcWake) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the GC loop to take the new interval")
+		}
+		<-time.After(time.Millisecond)
+	}
+	n := tc.Stats().GCRuns
+	<-time.After(30 * time.Millisecond)
+	if m := tc.Stats().GCRuns; m != n {
+		t.Error("Expected the GC to slow down, got runs:", n, m)
+	}
+	tc.StopGc()
+	tc.SetGCInterval(time.Millisecond)
+
+	tc = NewCache(DefaultExpiration, time.Millisecond)
+	defer tc.StopGc()
+	done := make(chan struct{}, 1)
+	tc.OnEvicted(func(k string, v interface{}) {
+		tc.SetGCInterval(time.Hour)
+		done <- struct{}{}
+	})
+	tc.Set("a", 1, time.Nanosecond)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected SetGCInterval not to block in an eviction callback run by the GC loop")
+	}
+}
+
+func TestDrain(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	evicted := 0
+	tc.OnEvicted(func(k string, v interface{}) {
+		evicted++
+	})
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, time.Hour)
+	tc.Set("expired", 3, time.Nanosecond)
+	<-time.After(time.Millisecond)
+	items := tc.Drain()
+	if len(items) != 2 || items["a"].Object != 1 || items["b"].Object != 2 || items["b"].Expiration == 0 {
+		t.Error("Expected the live items, got", items)
+	}
+	if tc.Count() != 0 || evicted != 0 {
+		t.Error("Expected an empty cache without evictions, got", tc.Count(), evicted)
+	}
+	tc.Close()
+	if items := tc.Drain(); items != nil {
+		t.Error("Expected a closed cache not to be drained, got", items)
+	}
+}
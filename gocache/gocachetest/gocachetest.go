@@ -0,0 +1,72 @@
+// Package gocachetest provides helpers to assert the state of a gocache.Cache in tests.
+package gocachetest
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/JmPotato/go_playground/gocache"
+)
+
+// TB is the subset of testing.TB used by the helpers.
+type TB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// AssertHas checks that key is live in c with a value deeply equal to want.
+func AssertHas(t TB, c *gocache.Cache, key string, want interface{}) bool {
+	t.Helper()
+	v, found := c.Get(key)
+	if !found {
+		t.Errorf("Expected key %s to be in the cache", key)
+		return false
+	}
+	if !reflect.DeepEqual(v, want) {
+		t.Errorf("Expected key %s to be %v, got %v", key, want, v)
+		return false
+	}
+	return true
+}
+
+// AssertMissing checks that key isn't live in c.
+func AssertMissing(t TB, c *gocache.Cache, key string) bool {
+	t.Helper()
+	if v, found := c.Get(key); found {
+		t.Errorf("Expected key %s not to be in the cache, got %v", key, v)
+		return false
+	}
+	return true
+}
+
+// AssertTTLApprox checks that key is live in c and expires in want, give or take tolerance.
+// A want of gocache.NoExpiration checks that the key never expires.
+func AssertTTLApprox(t TB, c *gocache.Cache, key string, want, tolerance time.Duration) bool {
+	t.Helper()
+	item, found := c.GetItem(key)
+	if !found {
+		t.Errorf("Expected key %s to be in the cache", key)
+		return false
+	}
+	if want == gocache.NoExpiration || item.Expiration == 0 {
+		if want != gocache.NoExpiration || item.Expiration != 0 {
+			t.Errorf("Expected key %s to expire in %v, got %v", key, want, ttl(item))
+			return false
+		}
+		return true
+	}
+	got := ttl(item)
+	if diff := got - want; diff > tolerance || diff < -tolerance {
+		t.Errorf("Expected key %s to expire in %v ± %v, got %v", key, want, tolerance, got)
+		return false
+	}
+	return true
+}
+
+// ttl returns the remaining time to live of item, NoExpiration if it never expires.
+func ttl(item gocache.Item) time.Duration {
+	if item.Expiration == 0 {
+		return gocache.NoExpiration
+	}
+	return time.Until(time.Unix(0, item.Expiration))
+}
@@ -0,0 +1,60 @@
+package gocachetest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/JmPotato/go_playground/gocache"
+)
+
+type recorder struct {
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertHas(t *testing.T) {
+	c := gocache.NewCache(gocache.DefaultExpiration, time.Hour)
+	defer c.StopGc()
+	c.Set("a", []int{1}, gocache.DefaultExpiration)
+	r := &recorder{}
+	if !AssertHas(r, c, "a", []int{1}) || len(r.errors) != 0 {
+		t.Error("Expected a to match, got", r.errors)
+	}
+	if AssertHas(r, c, "a", []int{2}) || AssertHas(r, c, "b", 1) || len(r.errors) != 2 {
+		t.Error("Expected 2 failures, got", r.errors)
+	}
+}
+
+func TestAssertMissing(t *testing.T) {
+	c := gocache.NewCache(gocache.DefaultExpiration, time.Hour)
+	defer c.StopGc()
+	c.Set("a", 1, gocache.DefaultExpiration)
+	r := &recorder{}
+	if !AssertMissing(r, c, "b") || AssertMissing(r, c, "a") || len(r.errors) != 1 {
+		t.Error("Expected 1 failure, got", r.errors)
+	}
+}
+
+func TestAssertTTLApprox(t *testing.T) {
+	c := gocache.NewCache(gocache.DefaultExpiration, time.Hour)
+	defer c.StopGc()
+	c.Set("a", 1, time.Minute)
+	c.Set("forever", 1, gocache.NoExpiration)
+	r := &recorder{}
+	if !AssertTTLApprox(r, c, "a", time.Minute, time.Second) ||
+		!AssertTTLApprox(r, c, "forever", gocache.NoExpiration, 0) || len(r.errors) != 0 {
+		t.Error("Expected the TTLs to match, got", r.errors)
+	}
+	if AssertTTLApprox(r, c, "a", time.Hour, time.Second) ||
+		AssertTTLApprox(r, c, "a", gocache.NoExpiration, 0) ||
+		AssertTTLApprox(r, c, "forever", time.Minute, time.Second) ||
+		AssertTTLApprox(r, c, "missing", time.Minute, time.Second) || len(r.errors) != 4 {
+		t.Error("Expected 4 failures, got", r.errors)
+	}
+}
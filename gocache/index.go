@@ -0,0 +1,105 @@
+package gocache
+
+import (
+	"sort"
+	"sync/atomic"
+)
+
+// store writes the item with key k and keeps the indexes up to date.
+func (c *Cache) store(k string, item Item) {
+	if c.spillDir != "" {
+		if old, found := c.items[k]; found {
+			c.dropSpilled(old.Object, item.Object)
+		}
+		if c.prespilled != nil {
+			item.Object, c.prespilled = c.prespilled, nil
+		} else {
+			item.Object = c.spill(item.Object)
+		}
+	}
+	if c.bucketWidth > 0 || c.values != nil {
+		if old, found := c.items[k]; found {
+			c.unindex(k, old)
+		}
+		c.index(k, item)
+	}
+	c.markDirty(k)
+	c.track(k)
+	c.items[k] = item
+	atomic.StoreInt64(&c.count, int64(len(c.items)))
+}
+
+// index adds an item to the optional indexes.
+func (c *Cache) index(k string, item Item) {
+	c.bucket(k, item.Expiration)
+	if c.values != nil && hashable(item.Object) {
+		keys, found := c.values[item.Object]
+		if !found {
+			keys = map[string]struct{}{}
+			c.values[item.Object] = keys
+		}
+		keys[k] = struct{}{}
+	}
+}
+
+// unindex removes an item from the optional indexes.
+func (c *Cache) unindex(k string, item Item) {
+	c.unbucket(k, item.Expiration)
+	if c.values != nil && hashable(item.Object) {
+		if keys, found := c.values[item.Object]; found {
+			delete(keys, k)
+			if len(keys) == 0 {
+				delete(c.values, item.Object)
+			}
+		}
+	}
+}
+
+// resetIndexes empties the optional indexes.
+func (c *Cache) resetIndexes() {
+	c.buckets = nil
+	if c.values != nil {
+		c.values = map[interface{}]map[string]struct{}{}
+	}
+}
+
+// WithValueIndex maintains a reverse index from values to keys for KeysForValue.
+// Only values that can be map keys are indexed, which excludes slices, maps, functions
+// and structs or arrays containing them. The index adds overhead to every write.
+func WithValueIndex() Option {
+	return func(c *Cache) {
+		c.values = map[interface{}]map[string]struct{}{}
+	}
+}
+
+// KeysForValue returns the sorted keys of the live items whose value is v, using the index kept by WithValueIndex.
+// It returns nil if the index isn't enabled or v can't be indexed.
+func (c *Cache) KeysForValue(v interface{}) []string {
+	if !hashable(v) {
+		return nil
+	}
+	c.mu.RLock()
+	var keys []string
+	for k := range c.values[v] {
+		if item := c.items[k]; !c.expired(item) {
+			keys = append(keys, k)
+		}
+	}
+	c.mu.RUnlock()
+	sort.Strings(keys)
+	return keys
+}
+
+// hashable reports whether v can be used as a map key without panicking.
+func hashable(v interface{}) (ok bool) {
+	if v == nil {
+		return false
+	}
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	_ = map[interface{}]struct{}{v: {}}
+	return true
+}
@@ -0,0 +1,36 @@
+package gocache
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestValueIndex(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour, WithValueIndex())
+	defer tc.StopGc()
+	tc.Set("a", "x", DefaultExpiration)
+	tc.Set("b", "x", DefaultExpiration)
+	tc.Set("c", "y", DefaultExpiration)
+	tc.Set("d", []int{1}, DefaultExpiration)
+	tc.Set("e", "x", time.Nanosecond)
+	<-time.After(time.Millisecond)
+	if keys := tc.KeysForValue("x"); !reflect.DeepEqual(keys, []string{"a", "b"}) {
+		t.Error("Unexpected keys for x:", keys)
+	}
+	tc.Set("b", "y", DefaultExpiration)
+	tc.Delete("a")
+	tc.DeleteExpired()
+	if keys := tc.KeysForValue("x"); keys != nil {
+		t.Error("Expected no keys for x, got", keys)
+	}
+	if keys := tc.KeysForValue("y"); !reflect.DeepEqual(keys, []string{"b", "c"}) {
+		t.Error("Unexpected keys for y:", keys)
+	}
+	if keys := tc.KeysForValue([]int{1}); keys != nil {
+		t.Error("Expected no keys for a slice, got", keys)
+	}
+	if len(tc.values) != 1 {
+		t.Error("The value index wasn't cleaned up:", tc.values)
+	}
+}
@@ -0,0 +1,67 @@
+package gocache
+
+import (
+	"fmt"
+	"time"
+)
+
+// ListPush appends v to the list stored with key k, creating it if the key is missing,
+// and sets the expiration of the whole list to d. Lists are stored as []interface{}
+// and copied on every push, so slices returned earlier never change.
+// It returns an error if the key holds a value that isn't a list.
+func (c *Cache) ListPush(k string, v interface{}, d time.Duration) error {
+	c.mu.Lock()
+	defer c.unlock()
+	var list []interface{}
+	if old, found := c.get(k); found {
+		var ok bool
+		if list, ok = old.([]interface{}); !ok {
+			return fmt.Errorf("The value for %s is not a list", k)
+		}
+	}
+	pushed := make([]interface{}, len(list), len(list)+1)
+	copy(pushed, list)
+	return c.set(k, append(pushed, v), d)
+}
+
+// ListRange returns a copy of the elements of the list stored with key k from start to stop, both included.
+// Negative indexes count from the end of the list, -1 being the last element, and out of range indexes are clamped.
+// It returns false if the key is missing or isn't a list.
+func (c *Cache) ListRange(k string, start, stop int) ([]interface{}, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	v, found := c.get(k)
+	if !found {
+		return nil, false
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	n := len(list)
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop {
+		return []interface{}{}, true
+	}
+	return append([]interface{}(nil), list[start:stop+1]...), true
+}
+
+// ListLen returns the length of the list stored with key k, 0 if the key is missing or isn't a list.
+func (c *Cache) ListLen(k string) int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	v, _ := c.get(k)
+	list, _ := v.([]interface{})
+	return len(list)
+}
@@ -0,0 +1,57 @@
+package gocache
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestList(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	for i := 0; i < 5; i++ {
+		if err := tc.ListPush("l", i, time.Hour); err != nil {
+			t.Fatal("Couldn't push:", err)
+		}
+	}
+	if n := tc.ListLen("l"); n != 5 {
+		t.Error("Expected 5 elements, got", n)
+	}
+	for _, c := range []struct {
+		start, stop int
+		want        []interface{}
+	}{
+		{0, -1, []interface{}{0, 1, 2, 3, 4}},
+		{1, 2, []interface{}{1, 2}},
+		{-2, 10, []interface{}{3, 4}},
+		{-10, 0, []interface{}{0}},
+		{3, 1, []interface{}{}},
+	} {
+		if got, ok := tc.ListRange("l", c.start, c.stop); !ok || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ListRange(%d, %d) = %v, want %v", c.start, c.stop, got, c.want)
+		}
+	}
+
+	got, _ := tc.ListRange("l", 0, -1)
+	tc.ListPush("l", 5, time.Hour)
+	if len(got) != 5 {
+		t.Error("Expected returned ranges not to change")
+	}
+
+	tc.Set("s", "string", DefaultExpiration)
+	if err := tc.ListPush("s", 1, DefaultExpiration); err == nil {
+		t.Error("Expected pushing to a non-list to fail")
+	}
+	if _, ok := tc.ListRange("s", 0, -1); ok {
+		t.Error("Expected ranging over a non-list to fail")
+	}
+	if _, ok := tc.ListRange("missing", 0, -1); ok || tc.ListLen("missing") != 0 {
+		t.Error("Expected a missing list to be empty")
+	}
+
+	tc.ListPush("e", 1, time.Nanosecond)
+	<-time.After(time.Millisecond)
+	if tc.ListLen("e") != 0 {
+		t.Error("Expected the list to expire as a whole")
+	}
+}
@@ -0,0 +1,442 @@
+package gocache
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// call is a load in progress, shared by the concurrent callers loading the same key.
+type call struct {
+	done   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	val    interface{}
+	err    error
+}
+
+// wait waits for the result of the call, or for its context to be done.
+func (cl *call) wait() (interface{}, error) {
+	select {
+	case <-cl.done:
+		return cl.val, cl.err
+	case <-cl.ctx.Done():
+		// Both may be ready, prefer the result
+		select {
+		case <-cl.done:
+			return cl.val, cl.err
+		default:
+			return nil, cl.ctx.Err()
+		}
+	}
+}
+
+// loadGroup coalesces concurrent loads of the same key.
+type loadGroup struct {
+	mu     sync.Mutex
+	calls  map[string]*call
+	errs   map[string]loadError
+	logger Logger
+}
+
+// loadError is a loader error cached until its expiration, see WithLoadErrorTTL.
+type loadError struct {
+	err        error
+	expiration int64
+}
+
+// do calls fn once for all the concurrent callers with the key k and returns its result to each of them.
+// fn gets a context derived from ctx, the context of the first caller, which is also canceled by cancel.
+// The other callers stop waiting with the context error once it's done. A panic in fn is returned as an error.
+func (g *loadGroup) do(ctx context.Context, k string, fn func(context.Context) (interface{}, error)) (val interface{}, err error) {
+	g.mu.Lock()
+	if cl, found := g.calls[k]; found {
+		g.mu.Unlock()
+		return cl.wait()
+	}
+	cl := &call{done: make(chan struct{})}
+	cl.ctx, cl.cancel = context.WithCancel(ctx)
+	if g.calls == nil {
+		g.calls = map[string]*call{}
+	}
+	g.calls[k] = cl
+	g.mu.Unlock()
+
+	defer func() {
+		if x := recover(); x != nil {
+			cl.val, cl.err = nil, fmt.Errorf("Loader panicked: %v", x)
+			val, err = cl.val, cl.err
+			if g.logger != nil {
+				g.logger.Errorf("Loader of %s panicked: %v", k, x)
+			}
+		}
+		g.mu.Lock()
+		if g.calls[k] == cl {
+			delete(g.calls, k)
+		}
+		g.mu.Unlock()
+		close(cl.done)
+		cl.cancel()
+	}()
+	cl.val, cl.err = fn(cl.ctx)
+	return cl.val, cl.err
+}
+
+// keys returns the sorted keys being loaded.
+func (g *loadGroup) keys() []string {
+	g.mu.Lock()
+	keys := make([]string, 0, len(g.calls))
+	for k := range g.calls {
+		keys = append(keys, k)
+	}
+	g.mu.Unlock()
+	sort.Strings(keys)
+	return keys
+}
+
+// cancel cancels the load of the key k and forgets it, so the next caller starts a new load.
+func (g *loadGroup) cancel(k string) bool {
+	g.mu.Lock()
+	cl, found := g.calls[k]
+	delete(g.calls, k)
+	g.mu.Unlock()
+	if found {
+		cl.cancel()
+	}
+	return found
+}
+
+// cachedErr returns the error cached for the key k if it hasn't expired at now.
+func (g *loadGroup) cachedErr(k string, now int64) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	le, found := g.errs[k]
+	if !found {
+		return nil
+	}
+	if now > le.expiration {
+		delete(g.errs, k)
+		return nil
+	}
+	return le.err
+}
+
+// cacheErr caches the error of the key k until expiration.
+func (g *loadGroup) cacheErr(k string, err error, expiration int64) {
+	g.mu.Lock()
+	if g.errs == nil {
+		g.errs = map[string]loadError{}
+	}
+	g.errs[k] = loadError{err: err, expiration: expiration}
+	g.mu.Unlock()
+}
+
+// deleteExpiredErrs forgets the cached errors expired at now.
+func (g *loadGroup) deleteExpiredErrs(now int64) {
+	g.mu.Lock()
+	for k, le := range g.errs {
+		if now > le.expiration {
+			delete(g.errs, k)
+		}
+	}
+	g.mu.Unlock()
+}
+
+// InflightLoads returns the sorted keys whose loader is running, to diagnose stuck loaders.
+func (c *Cache) InflightLoads() []string {
+	return c.loads.keys()
+}
+
+// CancelLoad cancels the context of the running load of key k and returns whether there was one.
+// Callers waiting for it get the cancellation error right away, and its value isn't stored,
+// while the loader itself only stops if it honors its context.
+func (c *Cache) CancelLoad(k string) bool {
+	return c.loads.cancel(k)
+}
+
+// readThrough returns the value of key k, calling loader on a miss and storing its value with the expiration d.
+// Concurrent callers share a single loader call, which waits for a slot with ctx.
+// Errors are only cached with WithLoadErrorTTL. loaded reports whether the value comes from the loader rather than the cache.
+func (c *Cache) readThrough(ctx context.Context, k string, d time.Duration, loader func(context.Context) (interface{}, error)) (value interface{}, loaded bool, err error) {
+	if v, found := c.Get(k); found {
+		return v, false, nil
+	}
+	if c.loadErrorTTL > 0 {
+		if err := c.loads.cachedErr(k, c.now()); err != nil {
+			return nil, false, err
+		}
+	}
+	v, err := c.loads.do(ctx, k, func(ctx context.Context) (interface{}, error) {
+		// Another caller may have stored the value since the first check
+		if v, found := c.Get(k); found {
+			return v, nil
+		}
+		if err := c.acquireLoad(ctx); err != nil {
+			return nil, err
+		}
+		defer c.releaseLoad()
+		v, err := loader(ctx)
+		if err != nil {
+			if c.loadErrorTTL > 0 && ctx.Err() == nil {
+				c.loads.cacheErr(k, err, c.deadline(c.loadErrorTTL))
+			}
+			return nil, err
+		}
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		c.Set(k, v, d)
+		return computed{v}, nil
+	})
+	if cv, ok := v.(computed); ok {
+		return cv.v, true, err
+	}
+	return v, false, err
+}
+
+// ignoreContext adapts a loader without a context for readThrough.
+func ignoreContext(loader func() (interface{}, error)) func(context.Context) (interface{}, error) {
+	return func(context.Context) (interface{}, error) {
+		return loader()
+	}
+}
+
+// refreshConcurrency bounds the loaders run at once by RefreshExpiringSoon.
+const refreshConcurrency = 8
+
+// RefreshExpiringSoon reloads the live items expiring within the given duration, calling loader for each,
+// at most a few at once and within the WithMaxConcurrentLoads limit, and replaces their value and expiration
+// with the ones it returns. It returns how many were refreshed and the loader errors, prefixed with their key,
+// including its recovered panics.
+// Items whose loader fails keep their value, and items deleted while loading aren't set again.
+func (c *Cache) RefreshExpiringSoon(within time.Duration, loader func(k string) (interface{}, time.Duration, error)) (refreshed int, errs []error) {
+	var keys []string
+	c.mu.RLock()
+	for k, v := range c.items {
+		if v.Expiration > 0 && !c.expired(v) && c.ttl(v) < within {
+			keys = append(keys, k)
+		}
+	}
+	c.mu.RUnlock()
+	sort.Strings(keys)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, refreshConcurrency)
+	for _, k := range keys {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(k string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			v, d, err := c.refreshLoad(k, loader)
+			if err == nil && !c.refresh(k, v, d) {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("Refreshing %s: %v", k, err))
+				return
+			}
+			refreshed++
+		}(k)
+	}
+	wg.Wait()
+	return refreshed, errs
+}
+
+// refreshLoad calls loader for key k within the WithMaxConcurrentLoads limit.
+// Like for the other loaders, its panics are recovered and returned as errors, since it runs on a goroutine of the cache.
+func (c *Cache) refreshLoad(k string, loader func(k string) (interface{}, time.Duration, error)) (v interface{}, d time.Duration, err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			v, d, err = nil, 0, fmt.Errorf("Loader panicked: %v", x)
+			if c.logger != nil {
+				c.logger.Errorf("Loader of %s panicked: %v", k, x)
+			}
+		}
+	}()
+	c.acquireLoad(context.Background())
+	defer c.releaseLoad()
+	return loader(k)
+}
+
+// refresh sets key k to v with the expiration d only if it's still in the cache, and returns whether it was set.
+func (c *Cache) refresh(k string, v interface{}, d time.Duration) bool {
+	c.mu.Lock()
+	defer c.unlock()
+	if _, found := c.items[k]; !found {
+		return false
+	}
+	return c.set(k, v, d) == nil
+}
+
+// computed marks a value returned by a loader rather than found in the cache.
+type computed struct {
+	v interface{}
+}
+
+// Memoize returns the value of key k, calling loader to compute it on first access.
+// The value is stored with NoExpiration, so loader runs once for the lifetime of the key,
+// until it's deleted explicitly. Concurrent callers share a single loader call, and errors aren't cached
+// unless WithLoadErrorTTL is set.
+func (c *Cache) Memoize(k string, loader func() (interface{}, error)) (interface{}, error) {
+	v, _, err := c.readThrough(context.Background(), k, NoExpiration, ignoreContext(loader))
+	return v, err
+}
+
+// Memoizer returns a memoized version of loader caching its results in c with the expiration d,
+// under the keys derived from its arguments by keyFn. Concurrent calls with the same key share a single
+// loader call, and errors aren't cached unless WithLoadErrorTTL is set. A value of another type stored
+// under a derived key by other means makes the memoized function return an error.
+func Memoizer[K comparable, V any](c *Cache, keyFn func(K) string, loader func(K) (V, error), d time.Duration) func(K) (V, error) {
+	return func(arg K) (V, error) {
+		k := keyFn(arg)
+		v, _, err := c.readThrough(context.Background(), k, d, func(context.Context) (interface{}, error) {
+			return loader(arg)
+		})
+		var zero V
+		if err != nil {
+			return zero, err
+		}
+		typed, ok := v.(V)
+		if !ok && v != nil {
+			return zero, fmt.Errorf("The value for %s is a %T, not a %T", k, v, zero)
+		}
+		return typed, nil
+	}
+}
+
+// GetOrLoad returns the value of key k, calling loader to load it on a miss and storing it with the expiration d.
+// Concurrent callers share a single loader call, which gets the context of the caller that started it,
+// and errors aren't cached unless WithLoadErrorTTL is set.
+func (c *Cache) GetOrLoad(ctx context.Context, k string, d time.Duration, loader func(context.Context) (interface{}, error)) (interface{}, error) {
+	v, _, err := c.readThrough(ctx, k, d, loader)
+	return v, err
+}
+
+// SetThrough writes v to the backing store with writer and only then sets it in the cache with the expiration d,
+// so the cache never holds a value the store rejected. It returns the writer error, with the cache left unchanged,
+// or the TrySet error. Concurrent writes of the same key may reach the store and the cache in different orders.
+func (c *Cache) SetThrough(k string, v interface{}, d time.Duration, writer func(k string, v interface{}) error) error {
+	if err := writer(k, v); err != nil {
+		return err
+	}
+	return c.TrySet(k, v, d)
+}
+
+// DeleteThrough deletes key k from the backing store with deleter and only then from the cache.
+// It returns the deleter error, with the cache left unchanged.
+func (c *Cache) DeleteThrough(k string, deleter func(k string) error) error {
+	if err := deleter(k); err != nil {
+		return err
+	}
+	c.Delete(k)
+	return nil
+}
+
+// GetOrCompute is like GetOrLoad without a context, and also returns whether f was called to compute the value,
+// as opposed to finding it in the cache. Callers sharing a computation all get true.
+func (c *Cache) GetOrCompute(k string, d time.Duration, f func() (interface{}, error)) (value interface{}, loaded bool, err error) {
+	return c.readThrough(context.Background(), k, d, ignoreContext(f))
+}
+
+// WithStaleGrace keeps expired items for grace before the GC deletes them,
+// so GetStale and GetOrLoadStale can still serve them when refreshing fails. Get treats them as missing as usual.
+func WithStaleGrace(grace time.Duration) Option {
+	return func(c *Cache) {
+		c.staleGrace = grace
+	}
+}
+
+// GetOrLoadStale returns the value of key k if it's fresh, and otherwise calls loader to load it
+// and stores it with the expiration d. If loader fails while an expired value is still in the cache,
+// see WithStaleGrace, that value is returned with stale set, along with the error.
+// Concurrent callers share a single loader call.
+func (c *Cache) GetOrLoadStale(k string, d time.Duration, loader func() (interface{}, error)) (value interface{}, stale bool, err error) {
+	v, _, err := c.readThrough(context.Background(), k, d, ignoreContext(loader))
+	if err == nil {
+		return v, false, nil
+	}
+	if v, fresh, found := c.GetStale(k); found {
+		return v, !fresh, err
+	}
+	return nil, false, err
+}
+
+// WithLoadErrorTTL caches loader errors for d, so the loads of a key failing within d of its last failure
+// return the same error without calling the loader again, sparing a failing backend a retry storm.
+// The first load after d calls the loader again. Errors due to the caller's context being done aren't cached.
+func WithLoadErrorTTL(d time.Duration) Option {
+	return func(c *Cache) {
+		c.loadErrorTTL = d
+	}
+}
+
+// WithMaxConcurrentLoads limits the loaders run by Memoize and GetOrLoad to n at once across all keys.
+// Callers over the limit wait for a slot, GetOrLoad callers until their context is done.
+func WithMaxConcurrentLoads(n int) Option {
+	return func(c *Cache) {
+		if n > 0 {
+			c.loadSlots = make(chan struct{}, n)
+		}
+	}
+}
+
+// acquireLoad waits for a loader slot if their number is limited.
+func (c *Cache) acquireLoad(ctx context.Context) error {
+	if c.loadSlots == nil {
+		return nil
+	}
+	select {
+	case c.loadSlots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// releaseLoad frees a loader slot taken by acquireLoad.
+func (c *Cache) releaseLoad() {
+	if c.loadSlots != nil {
+		<-c.loadSlots
+	}
+}
+
+// GetManyOrLoad returns the values of keys, calling loader once with all the missing keys
+// and storing the values it returns with the expiration d. Keys the loader doesn't return stay missing.
+// On a loader error, nothing is stored and only the error is returned.
+func (c *Cache) GetManyOrLoad(keys []string, loader func(missing []string) (map[string]interface{}, error), d time.Duration) (map[string]interface{}, error) {
+	found, missing := c.GetManySplit(keys)
+	if len(missing) == 0 {
+		return found, nil
+	}
+	if err := c.acquireLoad(context.Background()); err != nil {
+		return nil, err
+	}
+	loaded, err := func() (loaded map[string]interface{}, err error) {
+		defer c.releaseLoad()
+		defer func() {
+			if x := recover(); x != nil {
+				err = fmt.Errorf("Loader panicked: %v", x)
+				if c.logger != nil {
+					c.logger.Errorf("Batch loader panicked: %v", x)
+				}
+			}
+		}()
+		return loader(missing)
+	}()
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range missing {
+		if v, ok := loaded[k]; ok {
+			c.Set(k, v, d)
+			found[k] = v
+		}
+	}
+	return found, nil
+}
@@ -0,0 +1,441 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoize(t *testing.T) {
+	tc := NewCache(time.Millisecond, time.Hour)
+	defer tc.StopGc()
+	var calls int32
+	release := make(chan struct{})
+	loader := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "v", nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := tc.Memoize("a", loader); v != "v" || err != nil {
+				t.Error("Unexpected result:", v, err)
+			}
+		}()
+	}
+	<-time.After(5 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	<-time.After(5 * time.Millisecond)
+	if v, err := tc.Memoize("a", loader); v != "v" || err != nil {
+		t.Error("Unexpected result:", v, err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Error("Expected the loader to run once, ran", n)
+	}
+
+	tc.Delete("a")
+	tc.Memoize("a", loader)
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Error("Expected the loader to run again after deleting a, ran", n)
+	}
+
+	failed := errors.New("failed")
+	if _, err := tc.Memoize("b", func() (interface{}, error) { return nil, failed }); err != failed {
+		t.Error("Expected the loader error, got", err)
+	}
+	if _, found := tc.Get("b"); found {
+		t.Error("The error was cached")
+	}
+}
+
+func TestMemoizePanic(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	_, err := tc.Memoize("a", func() (interface{}, error) {
+		panic("boom")
+	})
+	if err == nil {
+		t.Error("Expected the panic to be returned as an error")
+	}
+	if v, err := tc.Memoize("a", func() (interface{}, error) { return 1, nil }); err != nil || v != 1 {
+		t.Error("Expected the next load to work, got", v, err)
+	}
+}
+
+func TestGetOrLoad(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	v, err := tc.GetOrLoad(context.Background(), "a", time.Hour, func(context.Context) (interface{}, error) {
+		return 1, nil
+	})
+	if err != nil || v != 1 {
+		t.Error("Expected the loaded value, got", v, err)
+	}
+	if item, _ := tc.GetItem("a"); item.Expiration == 0 {
+		t.Error("Expected the loaded value to expire")
+	}
+	v, err = tc.GetOrLoad(context.Background(), "a", time.Hour, func(context.Context) (interface{}, error) {
+		return 2, nil
+	})
+	if err != nil || v != 1 {
+		t.Error("Expected the cached value, got", v, err)
+	}
+}
+
+func TestMaxConcurrentLoads(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour, WithMaxConcurrentLoads(2))
+	defer tc.StopGc()
+	var running, max int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tc.GetOrLoad(context.Background(), strconv.Itoa(i), DefaultExpiration, func(context.Context) (interface{}, error) {
+				n := atomic.AddInt32(&running, 1)
+				for {
+					m := atomic.LoadInt32(&max)
+					if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+						break
+					}
+				}
+				<-time.After(5 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+				return i, nil
+			})
+		}(i)
+	}
+	wg.Wait()
+	if max > 2 {
+		t.Error("Expected at most 2 concurrent loads, got", max)
+	}
+	if tc.Count() != 10 {
+		t.Error("Expected every key to be loaded, got", tc.Count())
+	}
+
+	// A caller waiting for a slot gives up when its context is done.
+	block := make(chan struct{})
+	started := make(chan struct{}, 2)
+	for i := 0; i < 2; i++ {
+		go tc.Memoize("blocked"+strconv.Itoa(i), func() (interface{}, error) {
+			started <- struct{}{}
+			<-block
+			return nil, nil
+		})
+	}
+	<-started
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := tc.GetOrLoad(ctx, "late", DefaultExpiration, func(context.Context) (interface{}, error) {
+		return 1, nil
+	})
+	if err != context.DeadlineExceeded {
+		t.Error("Expected the context error, got", err)
+	}
+	close(block)
+}
+
+func TestGetManyOrLoad(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	tc.Set("a", 1, DefaultExpiration)
+	var calls [][]string
+	loader := func(missing []string) (map[string]interface{}, error) {
+		calls = append(calls, missing)
+		return map[string]interface{}{"b": 2, "c": 3, "z": 26}, nil
+	}
+	items, err := tc.GetManyOrLoad([]string{"a", "b", "c", "d"}, loader, DefaultExpiration)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if !reflect.DeepEqual(items, map[string]interface{}{"a": 1, "b": 2, "c": 3}) {
+		t.Error("Unexpected items:", items)
+	}
+	if !reflect.DeepEqual(calls, [][]string{{"b", "c", "d"}}) {
+		t.Error("Expected a single loader call with the missing keys, got", calls)
+	}
+	if _, found := tc.Get("z"); found {
+		t.Error("Expected keys that weren't asked for not to be stored")
+	}
+	if _, err = tc.GetManyOrLoad([]string{"a", "b"}, loader, DefaultExpiration); err != nil || len(calls) != 1 {
+		t.Error("Expected no loader call when every key is cached")
+	}
+	_, err = tc.GetManyOrLoad([]string{"e"}, func([]string) (map[string]interface{}, error) {
+		return nil, errors.New("boom")
+	}, DefaultExpiration)
+	if err == nil {
+		t.Error("Expected the loader error")
+	}
+}
+
+func TestGetOrCompute(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	v, loaded, err := tc.GetOrCompute("a", DefaultExpiration, func() (interface{}, error) {
+		return 1, nil
+	})
+	if err != nil || v != 1 || !loaded {
+		t.Error("Expected the value to be computed, got", v, loaded, err)
+	}
+	v, loaded, err = tc.GetOrCompute("a", DefaultExpiration, func() (interface{}, error) {
+		return 2, nil
+	})
+	if err != nil || v != 1 || loaded {
+		t.Error("Expected the cached value, got", v, loaded, err)
+	}
+	_, loaded, err = tc.GetOrCompute("b", DefaultExpiration, func() (interface{}, error) {
+		return nil, errors.New("boom")
+	})
+	if err == nil || loaded {
+		t.Error("Expected the error, got", loaded, err)
+	}
+	if _, found := tc.Get("b"); found {
+		t.Error("Expected errors not to be cached")
+	}
+}
+
+func TestGetOrLoadStale(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour, WithStaleGrace(time.Hour))
+	defer tc.StopGc()
+	failing := func() (interface{}, error) {
+		return nil, errors.New("boom")
+	}
+	tc.Set("a", 1, time.Nanosecond)
+	<-time.After(time.Millisecond)
+	tc.DeleteExpired()
+
+	v, stale, err := tc.GetOrLoadStale("a", DefaultExpiration, failing)
+	if err == nil || !stale || v != 1 {
+		t.Error("Expected the stale value with the error, got", v, stale, err)
+	}
+	if _, _, err = tc.GetOrLoadStale("missing", DefaultExpiration, failing); err == nil {
+		t.Error("Expected the error without a stale value")
+	}
+	v, stale, err = tc.GetOrLoadStale("a", DefaultExpiration, func() (interface{}, error) {
+		return 2, nil
+	})
+	if err != nil || stale || v != 2 {
+		t.Error("Expected the loaded value, got", v, stale, err)
+	}
+
+	tc = NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	tc.Set("a", 1, time.Nanosecond)
+	<-time.After(time.Millisecond)
+	tc.DeleteExpired()
+	if _, stale, _ = tc.GetOrLoadStale("a", DefaultExpiration, failing); stale {
+		t.Error("Expected expired items to be collected without a grace period")
+	}
+}
+
+func TestCancelLoad(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	started := make(chan struct{})
+	errs := make(chan error, 2)
+	go func() {
+		_, err := tc.GetOrLoad(context.Background(), "a", DefaultExpiration, func(ctx context.Context) (interface{}, error) {
+			close(started)
+			<-ctx.Done()
+			return 1, nil
+		})
+		errs <- err
+	}()
+	<-started
+	go func() {
+		_, err := tc.GetOrLoad(context.Background(), "a", DefaultExpiration, func(context.Context) (interface{}, error) {
+			return 2, nil
+		})
+		errs <- err
+	}()
+	if keys := tc.InflightLoads(); !reflect.DeepEqual(keys, []string{"a"}) {
+		t.Error("Expected a to be loading, got", keys)
+	}
+	// Give the second caller time to join the load
+	<-time.After(20 * time.Millisecond)
+	if !tc.CancelLoad("a") {
+		t.Error("Expected a load to cancel")
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != context.Canceled {
+			t.Error("Expected the cancellation error, got", err)
+		}
+	}
+	if _, found := tc.Get("a"); found {
+		t.Error("Expected the canceled load not to be stored")
+	}
+	if len(tc.InflightLoads()) != 0 || tc.CancelLoad("a") {
+		t.Error("Expected no load left")
+	}
+}
+
+func TestLoadErrorTTL(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour, WithLoadErrorTTL(20*time.Millisecond))
+	defer tc.StopGc()
+	var calls int32
+	fail := errors.New("backend down")
+	loader := func(context.Context) (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return nil, fail
+		}
+		return 1, nil
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := tc.GetOrLoad(context.Background(), "a", time.Hour, loader); err != fail {
+			t.Error("Expected the loader error, got", err)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Error("Expected the error to be cached, got calls:", n)
+	}
+	<-time.After(30 * time.Millisecond)
+	if _, err := tc.GetOrLoad(context.Background(), "a", time.Hour, loader); err != fail {
+		t.Error("Expected a retry failing again, got", err)
+	}
+	<-time.After(30 * time.Millisecond)
+	tc.RunGC()
+	if len(tc.loads.errs) != 0 {
+		t.Error("Expected the GC to forget expired errors, got", tc.loads.errs)
+	}
+	if v, err := tc.GetOrLoad(context.Background(), "a", time.Hour, loader); err != nil || v != 1 {
+		t.Error("Expected the retry to recover, got", v, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tc.GetOrLoad(ctx, "b", time.Hour, func(ctx context.Context) (interface{}, error) {
+		return nil, ctx.Err()
+	})
+	if err := tc.loads.cachedErr("b", tc.now()); err != nil {
+		t.Error("Expected context errors not to be cached, got", err)
+	}
+}
+
+func TestSetThrough(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	store := map[string]interface{}{}
+	fail := errors.New("rejected")
+	writer := func(k string, v interface{}) error {
+		if v.(int) < 0 {
+			return fail
+		}
+		store[k] = v
+		return nil
+	}
+	if err := tc.SetThrough("a", 1, DefaultExpiration, writer); err != nil || store["a"] != 1 {
+		t.Error("Expected the value to be written through, got", err, store)
+	}
+	if err := tc.SetThrough("a", -1, DefaultExpiration, writer); err != fail {
+		t.Error("Expected the writer error, got", err)
+	}
+	if v, _ := tc.Get("a"); v != 1 {
+		t.Error("Expected a rejected value not to be cached, got", v)
+	}
+
+	deleter := func(k string) error {
+		if k == "locked" {
+			return fail
+		}
+		delete(store, k)
+		return nil
+	}
+	tc.Set("locked", 2, DefaultExpiration)
+	if err := tc.DeleteThrough("locked", deleter); err != fail {
+		t.Error("Expected the deleter error, got", err)
+	}
+	if _, found := tc.Get("locked"); !found {
+		t.Error("Expected a failed delete to keep the cached value")
+	}
+	if err := tc.DeleteThrough("a", deleter); err != nil || len(store) != 0 {
+		t.Error("Expected the key to be deleted through, got", err, store)
+	}
+	if _, found := tc.Get("a"); found {
+		t.Error("Expected the key to be deleted from the cache")
+	}
+}
+
+func TestRefreshExpiringSoon(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	for i := 0; i < 20; i++ {
+		tc.Set(strconv.Itoa(i), i, time.Minute)
+	}
+	tc.Set("later", -1, time.Hour)
+	tc.Set("forever", -1, NoExpiration)
+	var calls int32
+	fail := errors.New("fail")
+	refreshed, errs := tc.RefreshExpiringSoon(10*time.Minute, func(k string) (interface{}, time.Duration, error) {
+		atomic.AddInt32(&calls, 1)
+		if k == "0" {
+			return nil, 0, fail
+		}
+		if k == "1" {
+			tc.Delete(k)
+		}
+		if k == "3" {
+			panic("boom")
+		}
+		return k, time.Hour, nil
+	})
+	if calls != 20 || refreshed != 17 {
+		t.Error("Expected the expiring items to be refreshed, got", calls, refreshed)
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	if len(errs) != 2 || errs[0].Error() != "Refreshing 0: fail" || !strings.Contains(errs[1].Error(), "Refreshing 3: Loader panicked: boom") {
+		t.Error("Expected the loader errors of 0 and 3, got", errs)
+	}
+	if v, _ := tc.Get("3"); v != 3 {
+		t.Error("Expected a panicking refresh to keep the value, got", v)
+	}
+	if v, _ := tc.Get("0"); v != 0 {
+		t.Error("Expected a failed refresh to keep the value, got", v)
+	}
+	if _, found := tc.Get("1"); found {
+		t.Error("Expected a deleted item not to be set again")
+	}
+	item, _ := tc.GetItem("2")
+	if v, _ := tc.Get("2"); v != "2" || time.Until(time.Unix(0, item.Expiration)) < 50*time.Minute {
+		t.Error("Expected 2 to be refreshed, got", v, item)
+	}
+}
+
+func TestMemoizer(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	var calls int32
+	square := Memoizer(tc, func(n int) string { return "square:" + strconv.Itoa(n) }, func(n int) (int, error) {
+		atomic.AddInt32(&calls, 1)
+		if n < 0 {
+			return 0, errors.New("negative")
+		}
+		return n * n, nil
+	}, time.Hour)
+	for i := 0; i < 3; i++ {
+		if v, err := square(4); err != nil || v != 16 {
+			t.Error("Expected 16, got", v, err)
+		}
+	}
+	if calls != 1 {
+		t.Error("Expected the loader to be called once, got", calls)
+	}
+	if _, err := square(-1); err == nil {
+		t.Error("Expected the loader error")
+	}
+	tc.Set("square:5", "five", DefaultExpiration)
+	if _, err := square(5); err == nil {
+		t.Error("Expected an error for a value of another type")
+	}
+}
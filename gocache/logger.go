@@ -0,0 +1,17 @@
+package gocache
+
+// Logger receives the notable events of the cache, such as GC runs, evictions and recovered panics.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// WithLogger logs the notable events of the cache to l, nothing is logged by default.
+// l is never called with the cache lock held.
+func WithLogger(l Logger) Option {
+	return func(c *Cache) {
+		c.logger = l
+		c.loads.logger = l
+	}
+}
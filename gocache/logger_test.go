@@ -0,0 +1,45 @@
+package gocache
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testLogger struct {
+	mu   sync.Mutex
+	logs []string
+}
+
+func (l *testLogger) logf(level, format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logs = append(l.logs, level+" "+fmt.Sprintf(format, args...))
+}
+
+func (l *testLogger) Debugf(format string, args ...interface{}) { l.logf("debug", format, args...) }
+func (l *testLogger) Warnf(format string, args ...interface{})  { l.logf("warn", format, args...) }
+func (l *testLogger) Errorf(format string, args ...interface{}) { l.logf("error", format, args...) }
+
+func TestLogger(t *testing.T) {
+	l := &testLogger{}
+	tc := NewCache(DefaultExpiration, time.Hour, WithLogger(l))
+	defer tc.StopGc()
+	tc.Set("a", 1, time.Nanosecond)
+	<-time.After(time.Millisecond)
+	tc.OnEvicted(func(string, interface{}) {
+		panic("callback")
+	})
+	tc.RunGC()
+	tc.Memoize("b", func() (interface{}, error) {
+		panic("loader")
+	})
+	logs := strings.Join(l.logs, "\n")
+	for _, want := range []string{"debug GC deleted 1 expired items", "error Callback panicked: callback", "error Loader of b panicked: loader"} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("Expected %q to be logged, got %q", want, logs)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package gocache
+
+import (
+	"runtime"
+	"sort"
+)
+
+// WithMemoryPressureEviction makes the GC loop check the process heap on every run and,
+// once it exceeds thresholdBytes, evict items until the cache's ApproxMemoryBytes is at most targetBytes.
+// Items closest to expiring are evicted first and items that never expire last.
+// Each check calls runtime.ReadMemStats, which briefly stops the world.
+func WithMemoryPressureEviction(thresholdBytes uint64, targetBytes int64) Option {
+	return func(c *Cache) {
+		c.memThreshold = thresholdBytes
+		c.memTarget = targetBytes
+	}
+}
+
+func (c *Cache) checkMemoryPressure() {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	if ms.HeapAlloc > c.memThreshold {
+		n := c.evictToBytes(c.memTarget)
+		if c.logger != nil && n > 0 {
+			c.logger.Warnf("Heap of %d bytes over the threshold, evicted %d items", ms.HeapAlloc, n)
+		}
+	}
+}
+
+// evictToBytes evicts items, closest to expiring first, until the approximate size of the cache is at most target,
+// and returns how many it evicted.
+func (c *Cache) evictToBytes(target int64) int {
+	type entry struct {
+		k    string
+		exp  int64
+		size int64
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	if c.frozen {
+		return 0
+	}
+	n := 0
+	var total int64
+	entries := make([]entry, 0, len(c.items))
+	for k, v := range c.items {
+		size := c.itemBytes(k, v)
+		total += size
+		entries = append(entries, entry{k: k, exp: v.Expiration, size: size})
+	}
+	if total > target {
+		sort.Slice(entries, func(i, j int) bool {
+			return expiresBefore(entries[i].exp, entries[j].exp)
+		})
+		for _, e := range entries {
+			if total <= target {
+				break
+			}
+			c.del(e.k, EvictMemoryPressure)
+			total -= e.size
+			n++
+		}
+	}
+	return n
+}
+
+// Compact rebuilds the map holding the items, releasing the memory it kept for deleted ones:
+// Go maps never shrink, so a cache that once held many more items than it does now keeps their memory.
+// It copies the items with the write lock held, so it's O(n).
+func (c *Cache) Compact() {
+	c.mu.Lock()
+	defer c.unlock()
+	c.compact()
+}
+
+// compact is Compact with the write lock held.
+func (c *Cache) compact() {
+	items := make(map[string]Item, len(c.items))
+	for k, v := range c.items {
+		items[k] = v
+	}
+	c.items = items
+	c.peakItems = len(items)
+}
+
+// WithAutoCompact compacts the cache, see Compact, whenever the share of the map's capacity wasted on deleted items,
+// estimated as the items deleted since the peak count over that peak, exceeds freeRatioThreshold, e.g. 0.5.
+// It reclaims the memory of caches whose size shrinks a lot after a peak, at the cost of rebuilding the map
+// with the write lock held, which happens after at least freeRatioThreshold times the peak count of deletions.
+func WithAutoCompact(freeRatioThreshold float64) Option {
+	return func(c *Cache) {
+		c.autoCompact = freeRatioThreshold
+	}
+}
+
+// maybeCompact compacts the cache if WithAutoCompact is set and enough of the map is wasted,
+// it must be called with the write lock held.
+func (c *Cache) maybeCompact() {
+	if len(c.items) > c.peakItems {
+		c.peakItems = len(c.items)
+	}
+	if c.peakItems > 0 && float64(c.peakItems-len(c.items))/float64(c.peakItems) > c.autoCompact {
+		c.compact()
+	}
+}
@@ -0,0 +1,66 @@
+package gocache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMemoryPressureEviction(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour, WithMemoryPressureEviction(1, 0))
+	defer tc.StopGc()
+	tc.Set("a", make([]byte, 1<<10), NoExpiration)
+	tc.Set("b", make([]byte, 1<<10), time.Hour)
+	tc.RunGC()
+	if n := tc.Count(); n != 0 {
+		t.Error("Expected all items to be evicted under memory pressure, got", n)
+	}
+
+	tc = NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	tc.Set("permanent", make([]byte, 1<<10), NoExpiration)
+	tc.Set("later", make([]byte, 1<<10), time.Hour)
+	tc.Set("sooner", make([]byte, 1<<10), time.Minute)
+	tc.evictToBytes(tc.ApproxMemoryBytes() - 1)
+	if _, found := tc.Get("sooner"); found {
+		t.Error("Expected the item closest to expiring to be evicted first")
+	}
+	if tc.Count() != 2 {
+		t.Error("Expected only one item to be evicted, got", 3-tc.Count())
+	}
+	tc.evictToBytes(tc.ApproxMemoryBytes() - 1)
+	if _, found := tc.Get("permanent"); !found {
+		t.Error("Expected the permanent item to be evicted last")
+	}
+}
+
+func TestAutoCompact(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour, WithAutoCompact(0.5))
+	defer tc.StopGc()
+	for i := 0; i < 1000; i++ {
+		tc.Set(strconv.Itoa(i), i, DefaultExpiration)
+	}
+	for i := 0; i < 500; i++ {
+		tc.Delete(strconv.Itoa(i))
+	}
+	if tc.peakItems != 1000 {
+		t.Error("Expected no compaction at the threshold, peak:", tc.peakItems)
+	}
+	tc.Delete("500")
+	if tc.peakItems != 499 {
+		t.Error("Expected a compaction past the threshold, peak:", tc.peakItems)
+	}
+	for i := 501; i < 1000; i++ {
+		if v, found := tc.Get(strconv.Itoa(i)); !found || v != i {
+			t.Fatal("Expected the compaction to keep the items, got", v, found)
+		}
+	}
+
+	tc = NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Compact()
+	if v, _ := tc.Get("a"); v != 1 || tc.Count() != 1 {
+		t.Error("Expected Compact to keep the items, got", v, tc.Count())
+	}
+}
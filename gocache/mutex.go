@@ -0,0 +1,11 @@
+//go:build !gocache_debug
+// +build !gocache_debug
+
+package gocache
+
+import "sync"
+
+// rwMutex is the lock of the cache, see mutex_debug.go for the checked version.
+type rwMutex struct {
+	sync.RWMutex
+}
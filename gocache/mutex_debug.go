@@ -0,0 +1,62 @@
+//go:build gocache_debug
+// +build gocache_debug
+
+package gocache
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// rwMutex is the lock of the cache built with the gocache_debug tag.
+// It panics when a goroutine locks it again while already holding it, which would otherwise deadlock,
+// typically because a callback invoked under the lock re-entered the cache.
+type rwMutex struct {
+	mu      sync.RWMutex
+	holders sync.Map // goroutine id -> struct{}
+}
+
+func (m *rwMutex) Lock() {
+	id := m.check()
+	m.mu.Lock()
+	m.holders.Store(id, struct{}{})
+}
+
+func (m *rwMutex) Unlock() {
+	m.holders.Delete(goid())
+	m.mu.Unlock()
+}
+
+func (m *rwMutex) RLock() {
+	id := m.check()
+	m.mu.RLock()
+	m.holders.Store(id, struct{}{})
+}
+
+func (m *rwMutex) RUnlock() {
+	m.holders.Delete(goid())
+	m.mu.RUnlock()
+}
+
+func (m *rwMutex) check() int64 {
+	id := goid()
+	if _, held := m.holders.Load(id); held {
+		panic("gocache: re-entrant cache call while holding the cache lock, " +
+			"a callback invoked under the lock must not use the cache")
+	}
+	return id
+}
+
+// goid returns the id of the current goroutine, parsed from its stack header.
+func goid() int64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+	if i := bytes.IndexByte(buf, ' '); i > 0 {
+		buf = buf[:i]
+	}
+	id, _ := strconv.ParseInt(string(buf), 10, 64)
+	return id
+}
@@ -0,0 +1,34 @@
+//go:build gocache_debug
+// +build gocache_debug
+
+package gocache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReentrantPanics(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	tc.mu.Lock()
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a re-entrant call to panic")
+		}
+	}()
+	tc.Get("a")
+}
+
+func TestCallbackMayUseCache(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	tc.OnEvicted(func(k string, v interface{}) {
+		tc.Set("evicted", k, DefaultExpiration)
+	})
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Delete("a")
+	if x, _ := tc.Get("evicted"); x != "a" {
+		t.Error("The eviction callback couldn't use the cache:", x)
+	}
+}
@@ -0,0 +1,142 @@
+package gocache
+
+import (
+	"encoding/gob"
+	"time"
+)
+
+// Option configures a cache created by NewCache.
+type Option func(*Cache)
+
+// OverflowPolicy decides what happens when the expired channel is full.
+type OverflowPolicy int
+
+const (
+	// DropNewest discards the notification that doesn't fit. It's the default so the GC never stalls.
+	DropNewest OverflowPolicy = iota
+	// DropOldest discards the oldest queued notification to make room, once. If there's still no room,
+	// e.g. with an unbuffered channel, it discards the new notification like DropNewest.
+	DropOldest
+	// Block waits for room, up to the overflow timeout.
+	Block
+)
+
+// WithExpiredChannel sends every item removed by DeleteExpired to ch.
+func WithExpiredChannel(ch chan KeyItem) Option {
+	return func(c *Cache) {
+		c.expiredCh = ch
+	}
+}
+
+// WithOverflowPolicy sets how a full expired channel is handled.
+// The timeout only applies to Block, a non-positive timeout blocks until there is room.
+// Dropped notifications are counted in Stats().ExpiredDropped.
+func WithOverflowPolicy(p OverflowPolicy, timeout time.Duration) Option {
+	return func(c *Cache) {
+		c.overflowPolicy = p
+		c.overflowTimeout = timeout
+	}
+}
+
+// WithEvictionWorkers runs eviction callbacks on a pool of workers fed by a queue of queueSize,
+// so slow callbacks don't stall the GC or the deleting caller.
+// Evicting blocks only once the queue is full.
+// Callbacks run in eviction order with a single worker, but there is no ordering guarantee with more.
+func WithEvictionWorkers(workers, queueSize int) Option {
+	return func(c *Cache) {
+		if workers <= 0 {
+			return
+		}
+		c.evictWorkers = workers
+		c.evictQueue = make(chan eviction, queueSize)
+	}
+}
+
+// WithGCBudget bounds how long each DeleteExpired run holds the write lock to d, so a GC pass over a large cache
+// can't cause a latency spike: it stops once it has spent d and leaves the remaining expired items to later runs.
+// See LastGCDuration to tune it.
+func WithGCBudget(d time.Duration) Option {
+	return func(c *Cache) {
+		c.gcBudget = d
+	}
+}
+
+// WithGCOnGrowth also runs the GC as soon as Set has grown the cache by n items since the last GC,
+// so bursts of inserts don't have to wait for the next interval.
+func WithGCOnGrowth(n int) Option {
+	return func(c *Cache) {
+		if n <= 0 {
+			return
+		}
+		c.gcGrowth = n
+		c.gcTrigger = make(chan struct{}, 1)
+	}
+}
+
+// WithObserver calls f after every Get, Set and Delete with the operation name, the key,
+// whether it hit and how long it took, e.g. to trace the cache.
+// A hit is a found key for Get and Delete and a stored item for Set.
+// f is called without holding the cache lock, and its panics are recovered like those of other callbacks.
+func WithObserver(f func(op, k string, hit bool, d time.Duration)) Option {
+	return func(c *Cache) {
+		c.observer = f
+	}
+}
+
+// WithEquals sets the function comparing values for DeleteIfEqual and CompareAndSwap,
+// instead of == for comparable types and reflect.DeepEqual otherwise.
+// f is called without holding the cache lock, like other callbacks, and may be called again if the item changes meanwhile.
+func WithEquals(f func(a, b interface{}) bool) Option {
+	return func(c *Cache) {
+		c.equals = f
+	}
+}
+
+// WithSerializer sets the Serializer used by Save and Load, GobSerializer by default.
+func WithSerializer(s Serializer) Option {
+	return func(c *Cache) {
+		c.serializer = s
+	}
+}
+
+// WithMaxKeyLength rejects keys longer than n bytes.
+// Writers returning an error, such as TrySet, Add and Replace, return ErrKeyTooLong for them,
+// while Set and the other writers silently ignore them.
+func WithMaxKeyLength(n int) Option {
+	return func(c *Cache) {
+		c.maxKeyLength = n
+	}
+}
+
+// WithDeleteOnExpiredGet sets whether Get deletes the expired items it finds instead of leaving them to the GC,
+// false by default. They're deleted as the GC would, with EvictExpired and expiry notifications,
+// which reclaims the memory of keys read but never set again sooner, at the cost of taking the write lock then.
+func WithDeleteOnExpiredGet(enabled bool) Option {
+	return func(c *Cache) {
+		c.deleteOnExpiredGet = enabled
+	}
+}
+
+// WithLazyExpiry sets whether Get checks expiration, true by default.
+// When false, Get returns whatever is stored and only the GC removes expired items,
+// so it may serve an expired value until the next GC run, in exchange for not evaluating expiry on every read.
+func WithLazyExpiry(lazy bool) Option {
+	return func(c *Cache) {
+		c.noLazyExpiry = !lazy
+	}
+}
+
+// WithGobTypes registers the given sample values of the cached types with gob once,
+// so the gob-based Save, Export and SaveDelta skip registering the type of every item each time.
+// Values of types that weren't registered then fail to encode.
+// It sets Registered on the serializer if it's a GobSerializer, in whatever order it's combined with WithSerializer,
+// and leaves other serializers alone.
+func WithGobTypes(types ...interface{}) Option {
+	return func(c *Cache) {
+		for _, t := range types {
+			gob.Register(t)
+			recordType(t)
+		}
+		c.gobRegistered = true
+	}
+}
@@ -0,0 +1,299 @@
+package gocache
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExpiredChannelOverflow(t *testing.T) {
+	ch := make(chan KeyItem, 1)
+	tc := NewCache(DefaultExpiration, time.Hour, WithExpiredChannel(ch))
+	defer tc.StopGc()
+	tc.Set("a", 1, time.Millisecond)
+	tc.Set("b", 2, time.Millisecond)
+	<-time.After(5 * time.Millisecond)
+	tc.DeleteExpired()
+	if len(ch) != 1 {
+		t.Error("Expected one notification in the channel, got", len(ch))
+	}
+	if n := tc.Stats().ExpiredDropped; n != 1 {
+		t.Error("Expected one dropped notification, got", n)
+	}
+
+	ch = make(chan KeyItem, 1)
+	tc = NewCache(DefaultExpiration, time.Hour, WithExpiredChannel(ch), WithOverflowPolicy(DropOldest, 0))
+	defer tc.StopGc()
+	tc.Set("a", 1, time.Millisecond)
+	<-time.After(5 * time.Millisecond)
+	tc.DeleteExpired()
+	tc.Set("b", 2, time.Millisecond)
+	<-time.After(5 * time.Millisecond)
+	tc.DeleteExpired()
+	if ki := <-ch; ki.Key != "b" {
+		t.Error("Expected the newest notification to be kept, got", ki.Key)
+	}
+	if n := tc.Stats().ExpiredDropped; n != 1 {
+		t.Error("Expected one dropped notification, got", n)
+	}
+
+	ch = make(chan KeyItem)
+	tc = NewCache(DefaultExpiration, time.Hour, WithExpiredChannel(ch), WithOverflowPolicy(DropOldest, 0))
+	defer tc.StopGc()
+	tc.Set("a", 1, time.Millisecond)
+	<-time.After(5 * time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		tc.RunGC()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected DropOldest not to stall the GC on an unbuffered channel")
+	}
+	if n := tc.Stats().ExpiredDropped; n != 1 {
+		t.Error("Expected the notification to be dropped, got", n)
+	}
+
+	ch = make(chan KeyItem)
+	tc = NewCache(DefaultExpiration, time.Hour, WithExpiredChannel(ch), WithOverflowPolicy(Block, time.Millisecond))
+	defer tc.StopGc()
+	tc.Set("a", 1, time.Millisecond)
+	<-time.After(5 * time.Millisecond)
+	tc.DeleteExpired()
+	if n := tc.Stats().ExpiredDropped; n != 1 {
+		t.Error("Expected the blocked notification to time out, got", n)
+	}
+}
+
+func TestEvictionWorkers(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour, WithEvictionWorkers(2, 100))
+	defer tc.StopGc()
+	release := make(chan struct{})
+	done := make(chan string, 10)
+	tc.OnEvicted(func(k string, v interface{}) {
+		<-release
+		done <- k
+	})
+	for _, k := range []string{"a", "b", "c"} {
+		tc.Set(k, k, time.Millisecond)
+	}
+	<-time.After(5 * time.Millisecond)
+	tc.DeleteExpired()
+	if tc.Count() != 0 {
+		t.Error("Expired items were not deleted")
+	}
+	close(release)
+	for i := 0; i < 3; i++ {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Eviction callbacks didn't run")
+		}
+	}
+}
+
+func TestEvictionWorkersClose(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour, WithEvictionWorkers(2, 100))
+	defer tc.StopGc()
+	var mu sync.Mutex
+	var evicted []string
+	tc.OnEvicted(func(k string, v interface{}) {
+		mu.Lock()
+		evicted = append(evicted, k)
+		mu.Unlock()
+	})
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Delete("a")
+	tc.Set("b", 2, time.Nanosecond)
+	tc.Close()
+	mu.Lock()
+	if len(evicted) != 1 {
+		t.Error("Expected Close to wait for the queued callbacks, got", evicted)
+	}
+	mu.Unlock()
+	<-time.After(time.Millisecond)
+	tc.DeleteExpired()
+	mu.Lock()
+	if len(evicted) != 2 {
+		t.Error("Expected callbacks to run inline once the workers stopped, got", evicted)
+	}
+	mu.Unlock()
+}
+
+func TestMaxKeyLength(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour, WithMaxKeyLength(3))
+	defer tc.StopGc()
+	if err := tc.TrySet("abc", 1, DefaultExpiration); err != nil {
+		t.Error("TrySet rejected a key within the limit:", err)
+	}
+	if err := tc.TrySet("abcd", 1, DefaultExpiration); err != ErrKeyTooLong {
+		t.Error("Expected ErrKeyTooLong from TrySet, got", err)
+	}
+	if err := tc.Add("abcd", 1, DefaultExpiration); err != ErrKeyTooLong {
+		t.Error("Expected ErrKeyTooLong from Add, got", err)
+	}
+	tc.Set("abcd", 1, DefaultExpiration)
+	if _, found := tc.Get("abcd"); found {
+		t.Error("Set stored a key over the limit")
+	}
+	if tc.Count() != 1 {
+		t.Error("Expected only abc to be stored, got", tc.Count())
+	}
+}
+
+func TestLazyExpiry(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour, WithLazyExpiry(false))
+	defer tc.StopGc()
+	tc.Set("a", 1, time.Nanosecond)
+	<-time.After(time.Millisecond)
+	if _, found := tc.Get("a"); !found {
+		t.Error("Expected Get to return the uncollected expired item")
+	}
+	tc.DeleteExpired()
+	if _, found := tc.Get("a"); found {
+		t.Error("Found a after the GC removed it")
+	}
+}
+
+func TestGCOnGrowth(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour, WithGCOnGrowth(10))
+	defer tc.StopGc()
+	for i := 0; i < 5; i++ {
+		tc.Set(strconv.Itoa(i), i, time.Nanosecond)
+	}
+	<-time.After(10 * time.Millisecond)
+	if tc.LastGCRun() != (time.Time{}) {
+		t.Error("Expected no GC before the threshold")
+	}
+	for i := 5; i < 10; i++ {
+		tc.Set(strconv.Itoa(i), i, DefaultExpiration)
+	}
+	deadline := time.Now().Add(time.Second)
+	for tc.LastGCRun() == (time.Time{}) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected growth to trigger the GC")
+		}
+		<-time.After(time.Millisecond)
+	}
+	if n := tc.Count(); n != 5 {
+		t.Error("Expected the expired items to be collected, got", n)
+	}
+}
+
+func TestObserver(t *testing.T) {
+	var ops []string
+	tc := NewCache(DefaultExpiration, time.Hour, WithMaxKeyLength(3), WithObserver(func(op, k string, hit bool, d time.Duration) {
+		if d < 0 {
+			t.Error("Negative duration for", op)
+		}
+		ops = append(ops, fmt.Sprintf("%s %s %v", op, k, hit))
+	}))
+	defer tc.StopGc()
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("long", 1, DefaultExpiration)
+	tc.Get("a")
+	tc.Get("b")
+	tc.Delete("a")
+	tc.Delete("a")
+	want := []string{"Set a true", "Set long false", "Get a true", "Get b false", "Delete a true", "Delete a false"}
+	if !reflect.DeepEqual(ops, want) {
+		t.Error("Unexpected observed operations:", ops)
+	}
+}
+
+func TestEquals(t *testing.T) {
+	caseInsensitive := func(a, b interface{}) bool {
+		sa, ok1 := a.(string)
+		sb, ok2 := b.(string)
+		return ok1 && ok2 && strings.EqualFold(sa, sb)
+	}
+	tc := NewCache(DefaultExpiration, time.Hour, WithEquals(caseInsensitive))
+	defer tc.StopGc()
+	tc.Set("a", "Hello", DefaultExpiration)
+	if !tc.CompareAndSwap("a", "HELLO", "World") {
+		t.Error("Expected CompareAndSwap to use the equality function")
+	}
+	if !tc.DeleteIfEqual("a", "world") {
+		t.Error("Expected DeleteIfEqual to use the equality function")
+	}
+
+	var tc2 *Cache
+	tc2 = NewCache(DefaultExpiration, time.Hour, WithEquals(func(a, b interface{}) bool {
+		tc2.Get("other")
+		return a == b
+	}))
+	defer tc2.StopGc()
+	tc2.Set("a", 1, DefaultExpiration)
+	done := make(chan bool)
+	go func() {
+		done <- tc2.CompareAndSwap("a", 1, 2) && tc2.DeleteIfEqual("a", 2)
+	}()
+	select {
+	case ok := <-done:
+		if !ok {
+			t.Error("Expected an equality function reading the cache to work")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the equality function to be called without the lock")
+	}
+}
+
+func TestGCBudget(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour, WithGCBudget(time.Nanosecond))
+	defer tc.StopGc()
+	if d := tc.LastGCDuration(); d != 0 {
+		t.Error("Expected no GC duration before the first run, got", d)
+	}
+	for i := 0; i < 10000; i++ {
+		tc.Set(strconv.Itoa(i), i, time.Nanosecond)
+	}
+	<-time.After(time.Millisecond)
+	tc.DeleteExpired()
+	if tc.LastGCDuration() <= 0 {
+		t.Error("Expected the GC duration to be recorded")
+	}
+	n := tc.Count()
+	if n == 0 || n == 10000 {
+		t.Error("Expected the GC to stop early after deleting some items, left", n)
+	}
+	for i := 0; i < 1000 && tc.Count() > 0; i++ {
+		tc.DeleteExpired()
+	}
+	if n := tc.Count(); n != 0 {
+		t.Error("Expected later runs to delete the remaining items, left", n)
+	}
+}
+
+func TestDeleteOnExpiredGet(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		tc := NewCache(DefaultExpiration, time.Hour, WithDeleteOnExpiredGet(enabled))
+		defer tc.StopGc()
+		var reasons []EvictReason
+		tc.OnEvictedWithReason(func(k string, v interface{}, reason EvictReason) {
+			reasons = append(reasons, reason)
+		})
+		tc.Set("a", 1, time.Nanosecond)
+		tc.Set("b", 2, DefaultExpiration)
+		<-time.After(time.Millisecond)
+		if _, found := tc.Get("a"); found {
+			t.Error("Expected a to have expired")
+		}
+		tc.Get("b")
+		tc.Get("missing")
+		if !enabled {
+			if tc.Count() != 2 || len(reasons) != 0 {
+				t.Error("Expected Get to leave the expired item to the GC, got", tc.Count(), reasons)
+			}
+			continue
+		}
+		if tc.Count() != 1 || len(reasons) != 1 || reasons[0] != EvictExpired || tc.Stats().Expired != 1 {
+			t.Error("Expected Get to delete the expired item, got", tc.Count(), reasons, tc.Stats())
+		}
+	}
+}
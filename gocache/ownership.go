@@ -0,0 +1,54 @@
+package gocache
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// WithKeyOwnership records the call site that first sets each key with Set, and calls f
+// with the key, that first call site and the current one whenever Set is called for the key from elsewhere,
+// to catch unrelated code accidentally sharing keys. The owner is forgotten when the key is deleted.
+// Looking up the caller makes Set much slower, so it's meant for development.
+func WithKeyOwnership(f func(k, owner, caller string)) Option {
+	return func(c *Cache) {
+		c.onKeyConflict = f
+		c.owners = map[string]string{}
+	}
+}
+
+// callSite returns the file and line of the first caller outside this package,
+// so wrappers of Set such as Upsert and SetForever report their own caller.
+func callSite() string {
+	_, self, _, ok := runtime.Caller(0)
+	if !ok {
+		return "unknown"
+	}
+	dir := filepath.Dir(self)
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		if filepath.Dir(frame.File) != dir || strings.HasSuffix(frame.File, "_test.go") {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+// claim records caller as the owner of the key k unless it already has one,
+// and returns the previous owner if it's a different call site.
+func (c *Cache) claim(k, caller string) string {
+	owner, found := c.owners[k]
+	if !found {
+		c.owners[k] = caller
+		return ""
+	}
+	if owner == caller {
+		return ""
+	}
+	return owner
+}
@@ -0,0 +1,43 @@
+package gocache
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyOwnership(t *testing.T) {
+	var conflicts []string
+	tc := NewCache(DefaultExpiration, time.Hour, WithKeyOwnership(func(k, owner, caller string) {
+		if !strings.Contains(owner, "ownership_test.go") || !strings.Contains(caller, "ownership_test.go") || owner == caller {
+			t.Error("Unexpected call sites:", owner, caller)
+		}
+		conflicts = append(conflicts, k)
+	}))
+	defer tc.StopGc()
+	set := func(k string) {
+		tc.Set(k, 1, DefaultExpiration)
+	}
+	for i := 0; i < 2; i++ {
+		set("a")
+		set("b")
+	}
+	if len(conflicts) != 0 {
+		t.Error("Expected no conflict from the same call site, got", conflicts)
+	}
+	tc.Set("a", 2, DefaultExpiration)
+	if len(conflicts) != 1 || conflicts[0] != "a" {
+		t.Error("Expected a conflict on a, got", conflicts)
+	}
+	tc.Delete("b")
+	tc.Set("b", 2, DefaultExpiration)
+	if len(conflicts) != 1 {
+		t.Error("Expected deleted keys to lose their owner, got", conflicts)
+	}
+
+	tc.Upsert("c", 1, DefaultExpiration)
+	tc.SetForever("c", 2)
+	if len(conflicts) != 2 || conflicts[1] != "c" {
+		t.Error("Expected wrappers of Set to report their own caller, got", conflicts)
+	}
+}
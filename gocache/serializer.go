@@ -0,0 +1,196 @@
+package gocache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+)
+
+// Serializer encodes and decodes the items persisted by Save and Load.
+type Serializer interface {
+	Encode(w io.Writer, items map[string]Item) error
+	Decode(r io.Reader) (map[string]Item, error)
+}
+
+// GobSerializer is the default Serializer, based on encoding/gob.
+// Values of primitive types, maps, slices and gob-registered structs round-trip through it.
+// Values gob can't encode, such as functions and channels, make Encode return an error naming the key.
+type GobSerializer struct {
+	// Registered skips registering the type of every item with gob on each Encode,
+	// for caches whose value types were all registered up front, see WithGobTypes.
+	Registered bool
+	// Sorted encodes the items in key order, so identical contents always encode to identical bytes,
+	// instead of in the random map iteration order. The items are then written as a list rather than a map,
+	// which Decode only reads when Sorted is set too, along with the unsorted format.
+	Sorted bool
+	// Fingerprints writes a header with a fingerprint of the layout of each value type before the items,
+	// and makes Decode, which then requires the header, fail with an error naming the first type whose
+	// local definition changed, instead of a cryptic gob error or silently dropped fields.
+	// Only the types registered by this package, when encoding or with WithGobTypes, are checked.
+	Fingerprints bool
+}
+
+// Encode writes items to w.
+func (s GobSerializer) Encode(w io.Writer, items map[string]Item) error {
+	if !s.Registered {
+		if err := registerItems(items); err != nil {
+			return err
+		}
+	}
+	enc := gob.NewEncoder(w)
+	if s.Fingerprints {
+		fps := fingerprints(items)
+		if err := enc.Encode(&fps); err != nil {
+			return err
+		}
+	}
+	if !s.Sorted {
+		return itemEncodeError(items, enc.Encode(&items))
+	}
+	sorted := make([]KeyItem, 0, len(items))
+	for k, v := range items {
+		sorted = append(sorted, KeyItem{Key: k, Item: v})
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Key < sorted[j].Key })
+	return itemEncodeError(items, enc.Encode(&sorted))
+}
+
+// itemEncodeError returns an error naming the first item, in key order, that gob fails to encode on its own
+// if encoding items failed with err, since gob's errors don't say which value they're about.
+// It returns err if every item encodes on its own, and nil if err is nil.
+func itemEncodeError(items map[string]Item, err error) error {
+	if err == nil {
+		return nil
+	}
+	keys := make([]string, 0, len(items))
+	for k := range items {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := items[k]
+		if ierr := gob.NewEncoder(ioutil.Discard).Encode(&v); ierr != nil {
+			return fmt.Errorf("Error encoding item %s: %v", k, ierr)
+		}
+	}
+	return err
+}
+
+// registerItems registers the types of the items with gob.
+func registerItems(items map[string]Item) error {
+	for k, v := range items {
+		if err := register(v.Object); err != nil {
+			return fmt.Errorf("Error registering item %s with Gob library: %v", k, err)
+		}
+	}
+	return nil
+}
+
+// Decode reads items from r.
+func (s GobSerializer) Decode(r io.Reader) (map[string]Item, error) {
+	if s.Fingerprints {
+		return decodeFingerprinted(r, s.Sorted)
+	}
+	if s.Sorted {
+		return decodeSorted(r)
+	}
+	var items map[string]Item
+	if err := gob.NewDecoder(r).Decode(&items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// decodeSorted reads items written by a sorted GobSerializer, falling back to the unsorted format.
+func decodeSorted(r io.Reader) (map[string]Item, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var sorted []KeyItem
+	if err = gob.NewDecoder(bytes.NewReader(data)).Decode(&sorted); err != nil {
+		var items map[string]Item
+		if gob.NewDecoder(bytes.NewReader(data)).Decode(&items) != nil {
+			return nil, err
+		}
+		return items, nil
+	}
+	items := make(map[string]Item, len(sorted))
+	for _, ki := range sorted {
+		items[ki.Key] = ki.Item
+	}
+	return items, nil
+}
+
+// decodeFingerprinted reads items written by a GobSerializer with Fingerprints, checking the fingerprints first.
+func decodeFingerprinted(r io.Reader, sorted bool) (map[string]Item, error) {
+	dec := gob.NewDecoder(r)
+	var fps map[string]string
+	if err := dec.Decode(&fps); err != nil {
+		return nil, fmt.Errorf("Error reading the type fingerprints: %v", err)
+	}
+	if err := checkFingerprints(fps); err != nil {
+		return nil, err
+	}
+	if !sorted {
+		var items map[string]Item
+		if err := dec.Decode(&items); err != nil {
+			return nil, err
+		}
+		return items, nil
+	}
+	var list []KeyItem
+	if err := dec.Decode(&list); err != nil {
+		return nil, err
+	}
+	items := make(map[string]Item, len(list))
+	for _, ki := range list {
+		items[ki.Key] = ki.Item
+	}
+	return items, nil
+}
+
+// register registers the type of v with gob.
+func register(v interface{}) (err error) {
+	if v == nil {
+		return nil
+	}
+	if err := encodable(reflect.TypeOf(v), map[reflect.Type]bool{}); err != nil {
+		return err
+	}
+	// Use recover() to catch registering error for interface{}
+	defer func() {
+		if x := recover(); x != nil {
+			err = fmt.Errorf("%v", x)
+		}
+	}()
+	gob.Register(v)
+	recordType(v)
+	return nil
+}
+
+// encodable returns an error if gob can't encode values of type t, which holds functions, channels
+// or unsafe pointers, at the top level or in the elements of slices, arrays, maps and pointers.
+// Struct fields of those types are ignored by gob, so structs aren't walked.
+func encodable(t reflect.Type, seen map[reflect.Type]bool) error {
+	if seen[t] {
+		return nil
+	}
+	seen[t] = true
+	switch t.Kind() {
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return fmt.Errorf("type %v can't be encoded", t)
+	case reflect.Array, reflect.Slice, reflect.Ptr:
+		return encodable(t.Elem(), seen)
+	case reflect.Map:
+		if err := encodable(t.Key(), seen); err != nil {
+			return err
+		}
+		return encodable(t.Elem(), seen)
+	}
+	return nil
+}
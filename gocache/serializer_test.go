@@ -0,0 +1,214 @@
+package gocache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type jsonSerializer struct{}
+
+func (jsonSerializer) Encode(w io.Writer, items map[string]Item) error {
+	return json.NewEncoder(w).Encode(items)
+}
+
+func (jsonSerializer) Decode(r io.Reader) (map[string]Item, error) {
+	var items map[string]Item
+	err := json.NewDecoder(r).Decode(&items)
+	return items, err
+}
+
+func TestCustomSerializer(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour, WithSerializer(jsonSerializer{}))
+	defer tc.StopGc()
+	tc.Set("a", "a", DefaultExpiration)
+	var buf bytes.Buffer
+	if err := tc.Save(&buf); err != nil {
+		t.Fatal("Couldn't save cache:", err)
+	}
+	if !json.Valid(buf.Bytes()) {
+		t.Error("The snapshot isn't JSON:", buf.String())
+	}
+	oc := NewCache(DefaultExpiration, time.Hour, WithSerializer(jsonSerializer{}))
+	defer oc.StopGc()
+	if err := oc.Load(&buf); err != nil {
+		t.Fatal("Couldn't load cache:", err)
+	}
+	if x, _ := oc.Get("a"); x != "a" {
+		t.Error("a didn't round-trip:", x)
+	}
+}
+
+type gobTypeStruct struct {
+	A int
+}
+
+type unregisteredStruct struct {
+	B int
+}
+
+func TestGobTypes(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour, WithGobTypes(gobTypeStruct{}))
+	defer tc.StopGc()
+	tc.Set("a", gobTypeStruct{A: 1}, DefaultExpiration)
+	var buf bytes.Buffer
+	if err := tc.Save(&buf); err != nil {
+		t.Fatal("Couldn't save cache:", err)
+	}
+	oc := NewCache(DefaultExpiration, time.Hour)
+	defer oc.StopGc()
+	if err := oc.Load(&buf); err != nil {
+		t.Fatal("Couldn't load cache:", err)
+	}
+	if x, _ := oc.Get("a"); x != (gobTypeStruct{A: 1}) {
+		t.Error("a didn't round-trip:", x)
+	}
+
+	tc.Set("b", unregisteredStruct{B: 1}, DefaultExpiration)
+	if err := tc.Save(&buf); err == nil {
+		t.Error("Expected an error saving an unregistered type")
+	}
+}
+
+func TestGobTypesSerializer(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour, WithSerializer(CompactSerializer{}), WithGobTypes(gobTypeStruct{}))
+	defer tc.StopGc()
+	if _, ok := tc.serializer.(CompactSerializer); !ok {
+		t.Errorf("Expected WithGobTypes to keep the serializer, got %T", tc.serializer)
+	}
+	for _, opts := range [][]Option{
+		{WithSerializer(GobSerializer{Sorted: true}), WithGobTypes(gobTypeStruct{})},
+		{WithGobTypes(gobTypeStruct{}), WithSerializer(GobSerializer{Sorted: true})},
+	} {
+		tc = NewCache(DefaultExpiration, time.Hour, opts...)
+		defer tc.StopGc()
+		if s, _ := tc.serializer.(GobSerializer); !s.Registered || !s.Sorted {
+			t.Error("Expected a registered sorted GobSerializer in any option order, got", tc.serializer)
+		}
+	}
+}
+
+func TestSortedGobSerializer(t *testing.T) {
+	save := func(c *Cache) []byte {
+		var buf bytes.Buffer
+		if err := c.Save(&buf); err != nil {
+			t.Fatal("Couldn't save cache:", err)
+		}
+		return buf.Bytes()
+	}
+	opt := WithSerializer(GobSerializer{Sorted: true})
+	tc := NewCache(DefaultExpiration, time.Hour, opt)
+	defer tc.StopGc()
+	for i := 0; i < 50; i++ {
+		tc.Set(strconv.Itoa(i), gobTypeStruct{A: i}, NoExpiration)
+		tc.Set("s"+strconv.Itoa(i), "s", NoExpiration)
+	}
+	first := save(tc)
+	for i := 0; i < 10; i++ {
+		if !bytes.Equal(first, save(tc)) {
+			t.Fatal("Expected identical contents to save to identical bytes")
+		}
+	}
+
+	oc := NewCache(DefaultExpiration, time.Hour, opt)
+	defer oc.StopGc()
+	if err := oc.Load(bytes.NewReader(first)); err != nil {
+		t.Fatal("Couldn't load cache:", err)
+	}
+	if x, _ := oc.Get("7"); x != (gobTypeStruct{A: 7}) {
+		t.Error("7 didn't round-trip:", x)
+	}
+
+	// Snapshots saved unsorted can still be loaded.
+	unsorted := NewCache(DefaultExpiration, time.Hour)
+	defer unsorted.StopGc()
+	unsorted.Set("a", 1, NoExpiration)
+	oc = NewCache(DefaultExpiration, time.Hour, opt)
+	defer oc.StopGc()
+	if err := oc.Load(bytes.NewReader(save(unsorted))); err != nil {
+		t.Fatal("Couldn't load unsorted snapshot:", err)
+	}
+	if x, _ := oc.Get("a"); x != 1 {
+		t.Error("a didn't round-trip:", x)
+	}
+	if err := oc.Load(bytes.NewReader([]byte("garbage"))); err == nil {
+		t.Error("Expected garbage to fail to load")
+	}
+}
+
+type fingerprintNode struct {
+	Value int
+	Next  *fingerprintNode
+}
+
+func TestGobFingerprints(t *testing.T) {
+	opt := WithSerializer(GobSerializer{Fingerprints: true})
+	tc := NewCache(DefaultExpiration, time.Hour, opt)
+	defer tc.StopGc()
+	tc.Set("a", gobTypeStruct{A: 1}, NoExpiration)
+	tc.Set("n", fingerprintNode{Value: 1, Next: &fingerprintNode{Value: 2}}, NoExpiration)
+	var buf bytes.Buffer
+	if err := tc.Save(&buf); err != nil {
+		t.Fatal("Couldn't save cache:", err)
+	}
+	oc := NewCache(DefaultExpiration, time.Hour, opt)
+	defer oc.StopGc()
+	if err := oc.Load(&buf); err != nil {
+		t.Fatal("Couldn't load cache:", err)
+	}
+	if x, _ := oc.Get("a"); x != (gobTypeStruct{A: 1}) {
+		t.Error("a didn't round-trip:", x)
+	}
+
+	// A snapshot saved with another layout of gobTypeStruct
+	name := typeName(reflect.TypeOf(gobTypeStruct{}))
+	buf.Reset()
+	enc := gob.NewEncoder(&buf)
+	enc.Encode(map[string]string{name: "0000000000000000"})
+	enc.Encode(map[string]Item{"a": {Object: gobTypeStruct{A: 1}}})
+	err := oc.Load(&buf)
+	if err == nil || !strings.Contains(err.Error(), name) {
+		t.Error("Expected an error naming the changed type, got", err)
+	}
+
+	if fingerprint(reflect.TypeOf(gobTypeStruct{})) == fingerprint(reflect.TypeOf(unregisteredStruct{})) {
+		t.Error("Expected different types to have different fingerprints")
+	}
+}
+
+func TestUnencodableNested(t *testing.T) {
+	type opaque struct{ f func() }
+	values := map[string]interface{}{
+		"funcs":  []func(){func() {}},
+		"chans":  map[string]chan int{"a": nil},
+		"opaque": opaque{},
+	}
+	for name, v := range values {
+		for _, registered := range []bool{false, true} {
+			var opts []Option
+			if registered {
+				opts = append(opts, WithGobTypes())
+			}
+			tc := NewCache(DefaultExpiration, time.Hour, append(opts, WithDeltaTracking())...)
+			defer tc.StopGc()
+			tc.Set("ok", 1, DefaultExpiration)
+			tc.Set("bad", v, DefaultExpiration)
+			var buf bytes.Buffer
+			if err := tc.Save(&buf); err == nil || !strings.Contains(err.Error(), "item bad") {
+				t.Error("Expected Save to name the offending key of", name, "got", err)
+			}
+			if err := tc.Export(&buf); err == nil || !strings.Contains(err.Error(), "item bad") {
+				t.Error("Expected Export to name the offending key of", name, "got", err)
+			}
+			if err := tc.SaveDelta(&buf); err == nil || !strings.Contains(err.Error(), "item bad") {
+				t.Error("Expected SaveDelta to name the offending key of", name, "got", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package gocache
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// maxSizeDepth bounds how deep sizeOf follows references, which also protects it from cycles.
+const maxSizeDepth = 8
+
+var itemSize = int64(reflect.TypeOf(Item{}).Size() + reflect.TypeOf("").Size())
+
+// ApproxMemoryBytes returns a rough estimate of the memory used by the live items.
+// It sums the key lengths and a best-effort size of each value found by reflection,
+// ignoring sharing and allocator overhead, so it's only meant for order-of-magnitude capacity planning.
+// It walks all items under the read lock, so it's O(n).
+func (c *Cache) ApproxMemoryBytes() int64 {
+	var n int64
+	now := c.now()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for k, v := range c.items {
+		if v.Expiration > 0 && now > v.Expiration {
+			continue
+		}
+		n += c.itemBytes(k, v)
+	}
+	return n
+}
+
+// WithSizeFunc makes ApproxMemoryBytes and WithMemoryPressureEviction size the values of type t with f
+// instead of estimating it by reflection, e.g. for types holding buffers the estimate can't see.
+// f gets the value and returns its size in bytes, it only applies to values of exactly that type,
+// not to the values nested in other ones.
+// Unlike other callbacks, f is called with the cache lock held, since values are sized while they're stored
+// and while scanning the items, so it must not call into the cache. Its panics are recovered: writers returning
+// an error return them as one and reject the value, and sizes are otherwise estimated by reflection instead.
+func WithSizeFunc(t reflect.Type, f func(interface{}) int64) Option {
+	return func(c *Cache) {
+		if c.sizeFuncs == nil {
+			c.sizeFuncs = map[reflect.Type]func(interface{}) int64{}
+		}
+		c.sizeFuncs[t] = f
+	}
+}
+
+// WithMaxValueBytes rejects values larger than n bytes, as estimated by ApproxMemoryBytes,
+// so a single unexpectedly large value can't blow the memory budget. Use WithSizeFunc for accurate sizes.
+// Writers returning an error, such as TrySet, Add and Replace, return ErrValueTooLarge for them,
+// while Set and the other writers silently ignore them, leaving any previous value in place.
+func WithMaxValueBytes(n int64) Option {
+	return func(c *Cache) {
+		c.maxValueBytes = n
+	}
+}
+
+// itemBytes estimates the memory used by an item and its key.
+func (c *Cache) itemBytes(k string, v Item) int64 {
+	return itemSize + int64(len(k)) + c.valueBytes(v.Object)
+}
+
+// valueBytes estimates the memory used by a value.
+// If the WithSizeFunc function panics, the value is estimated by reflection instead.
+func (c *Cache) valueBytes(v interface{}) int64 {
+	n, err := c.valueSize(v)
+	if err != nil {
+		return sizeOf(reflect.ValueOf(v), 0)
+	}
+	return n
+}
+
+// valueSize is valueBytes, but returns the panic of the WithSizeFunc function as an error.
+// Since it's called with the lock held, the panic is recovered so it can't leave the cache locked,
+// and it's also available from LastCallbackError.
+func (c *Cache) valueSize(v interface{}) (n int64, err error) {
+	f, found := c.sizeFuncs[reflect.TypeOf(v)]
+	if !found {
+		return sizeOf(reflect.ValueOf(v), 0), nil
+	}
+	defer func() {
+		if x := recover(); x != nil {
+			err = fmt.Errorf("Size function panicked: %v", x)
+			c.callbackErr.Store(storedError{err})
+		}
+	}()
+	return f(v), nil
+}
+
+// sizeOf estimates the memory referenced by v, including v itself.
+func sizeOf(v reflect.Value, depth int) int64 {
+	if !v.IsValid() {
+		return 0
+	}
+	n := int64(v.Type().Size())
+	if depth >= maxSizeDepth {
+		return n
+	}
+	switch v.Kind() {
+	case reflect.String:
+		n += int64(v.Len())
+	case reflect.Slice:
+		if v.IsNil() {
+			break
+		}
+		n += int64(v.Cap()) * int64(v.Type().Elem().Size())
+		n += sizeOfElems(v, depth)
+	case reflect.Array:
+		n += sizeOfElems(v, depth)
+	case reflect.Map:
+		if v.IsNil() {
+			break
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			n += sizeOf(iter.Key(), depth+1) + sizeOf(iter.Value(), depth+1)
+		}
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			n += sizeOf(v.Elem(), depth+1)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Field(i)
+			n += sizeOf(f, depth+1) - int64(f.Type().Size())
+		}
+	}
+	return n
+}
+
+// sizeOfElems estimates the memory referenced by the elements of a slice or an array, excluding the elements themselves.
+func sizeOfElems(v reflect.Value, depth int) int64 {
+	elem := v.Type().Elem()
+	if isFlat(elem) {
+		return 0
+	}
+	var n int64
+	for i := 0; i < v.Len(); i++ {
+		n += sizeOf(v.Index(i), depth+1) - int64(elem.Size())
+	}
+	return n
+}
+
+// isFlat reports whether values of t don't reference other memory.
+func isFlat(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return true
+	case reflect.Array:
+		return isFlat(t.Elem())
+	}
+	return false
+}
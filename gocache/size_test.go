@@ -0,0 +1,170 @@
+package gocache
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApproxMemoryBytes(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	if n := tc.ApproxMemoryBytes(); n != 0 {
+		t.Error("Expected an empty cache to use 0 bytes, got", n)
+	}
+	tc.Set("small", 1, DefaultExpiration)
+	small := tc.ApproxMemoryBytes()
+	tc.Set("big", strings.Repeat("x", 1<<20), DefaultExpiration)
+	tc.Set("slice", make([]string, 1000), DefaultExpiration)
+	tc.Set("map", map[string][]byte{"a": make([]byte, 1<<10)}, DefaultExpiration)
+	tc.Set("expired", strings.Repeat("x", 1<<20), time.Nanosecond)
+	<-time.After(time.Millisecond)
+	n := tc.ApproxMemoryBytes()
+	if n < small+1<<20+1<<10 || n > small+2<<20 {
+		t.Error("Unexpected memory estimate:", n)
+	}
+}
+
+type bufferedValue struct {
+	handle uintptr
+}
+
+func TestSizeFunc(t *testing.T) {
+	sizer := func(v interface{}) int64 {
+		return 1 << 20
+	}
+	tc := NewCache(DefaultExpiration, time.Hour, WithSizeFunc(reflect.TypeOf(bufferedValue{}), sizer))
+	defer tc.StopGc()
+	tc.Set("a", bufferedValue{}, DefaultExpiration)
+	if n := tc.ApproxMemoryBytes(); n != itemSize+1+1<<20 {
+		t.Error("Expected the size function to be used, got", n)
+	}
+	tc.Set("b", &bufferedValue{}, DefaultExpiration)
+	if n := tc.ApproxMemoryBytes(); n > itemSize+1+1<<20+itemSize+1+64 {
+		t.Error("Expected other types to be estimated by reflection, got", n)
+	}
+}
+
+func TestMaxValueBytes(t *testing.T) {
+	type blob struct{ n int64 }
+	tc := NewCache(DefaultExpiration, time.Hour, WithMaxValueBytes(100), WithSizeFunc(reflect.TypeOf(blob{}), func(v interface{}) int64 {
+		return v.(blob).n
+	}))
+	defer tc.StopGc()
+	if err := tc.TrySet("a", strings.Repeat("x", 50), DefaultExpiration); err != nil {
+		t.Error("Expected a small value to be accepted, got", err)
+	}
+	if err := tc.TrySet("a", strings.Repeat("x", 200), DefaultExpiration); err != ErrValueTooLarge {
+		t.Error("Expected ErrValueTooLarge, got", err)
+	}
+	tc.Set("a", strings.Repeat("x", 200), DefaultExpiration)
+	if v, _ := tc.Get("a"); len(v.(string)) != 50 {
+		t.Error("Expected Set to ignore the large value, got", len(v.(string)))
+	}
+	if err := tc.Add("b", blob{1000}, DefaultExpiration); err != ErrValueTooLarge {
+		t.Error("Expected the size func to be used, got", err)
+	}
+	if err := tc.Add("b", blob{10}, DefaultExpiration); err != nil {
+		t.Error("Expected a small blob to be accepted, got", err)
+	}
+	if tc.SetKeepTTL("b", blob{1000}) {
+		t.Error("Expected SetKeepTTL to reject the large value")
+	}
+	if tc.CompareAndSwap("b", blob{10}, blob{1000}) {
+		t.Error("Expected CompareAndSwap to reject the large value")
+	}
+	if v, _ := tc.Get("b"); v != (blob{10}) {
+		t.Error("Expected the small blob to be kept, got", v)
+	}
+	tc.ReplaceAll(map[string]interface{}{"c": blob{10}, "d": blob{1000}}, DefaultExpiration)
+	if _, found := tc.Get("d"); found || tc.Count() != 1 {
+		t.Error("Expected ReplaceAll to leave the large value out, got", tc.Count())
+	}
+}
+
+func TestSizeFuncPanic(t *testing.T) {
+	type blob struct{}
+	tc := NewCache(DefaultExpiration, time.Hour, WithMaxValueBytes(100), WithSizeFunc(reflect.TypeOf(blob{}), func(v interface{}) int64 {
+		panic("boom")
+	}))
+	defer tc.StopGc()
+	if err := tc.TrySet("a", blob{}, DefaultExpiration); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Error("Expected the panic to be returned as an error, got", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		tc.Set("a", blob{}, DefaultExpiration)
+		tc.Set("b", 1, DefaultExpiration)
+		tc.ApproxMemoryBytes()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected a panicking size function not to leave the cache locked")
+	}
+	if _, found := tc.Get("a"); found {
+		t.Error("Expected the value to be rejected")
+	}
+	if v, _ := tc.Get("b"); v != 1 {
+		t.Error("Expected other values to be stored, got", v)
+	}
+	if err := tc.LastCallbackError(); err == nil {
+		t.Error("Expected the panic to be recorded")
+	}
+}
+
+func TestLoadSkipsRejectedItems(t *testing.T) {
+	src := NewCache(DefaultExpiration, time.Hour, WithDeltaTracking())
+	defer src.StopGc()
+	src.Set("a", "small", DefaultExpiration)
+	src.Set("long", "small", DefaultExpiration)
+	src.Set("b", strings.Repeat("x", 200), DefaultExpiration)
+	newCache := func(opts ...Option) *Cache {
+		return NewCache(DefaultExpiration, time.Hour, append(opts, WithMaxKeyLength(3), WithMaxValueBytes(100))...)
+	}
+	check := func(name string, tc *Cache) {
+		if _, found := tc.Get("a"); !found {
+			t.Error(name, "dropped an accepted item")
+		}
+		if n := tc.Count(); n != 1 {
+			t.Error(name, "stored rejected items, got", n)
+		}
+	}
+
+	var buf bytes.Buffer
+	src.Save(&buf)
+	tc := newCache()
+	defer tc.StopGc()
+	if err := tc.Load(&buf); err != nil {
+		t.Fatal("Load failed:", err)
+	}
+	check("Load", tc)
+
+	buf.Reset()
+	src.Export(&buf)
+	tc = newCache()
+	defer tc.StopGc()
+	if err := tc.Import(&buf); err != nil {
+		t.Fatal("Import failed:", err)
+	}
+	check("Import", tc)
+
+	buf.Reset()
+	src.SaveDelta(&buf)
+	tc = newCache()
+	defer tc.StopGc()
+	if err := tc.ApplyDelta(&buf); err != nil {
+		t.Fatal("ApplyDelta failed:", err)
+	}
+	check("ApplyDelta", tc)
+
+	tc = newCache(WithFallbacks(0, src))
+	defer tc.StopGc()
+	for _, k := range []string{"a", "long", "b"} {
+		tc.Get(k)
+	}
+	check("Promotion", tc)
+}
@@ -0,0 +1,89 @@
+package gocache
+
+import (
+	"hash/maphash"
+	"sync"
+)
+
+const sketchDepth = 4
+
+// cmSketch is a count-min sketch estimating how often keys are accessed in bounded memory.
+// Counters are halved every resetAt increments so the estimates favor recent accesses.
+type cmSketch struct {
+	mu        sync.Mutex
+	seed      maphash.Seed
+	rows      [sketchDepth][]uint8
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+// newCMSketch creates a sketch sized for about n distinct keys.
+func newCMSketch(n int) *cmSketch {
+	width := 64
+	for width < n {
+		width <<= 1
+	}
+	s := &cmSketch{
+		seed:    maphash.MakeSeed(),
+		mask:    uint64(width - 1),
+		resetAt: 10 * width,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+// indexes derives the counter index of k in every row by remixing a single hash per row.
+func (s *cmSketch) indexes(k string) [sketchDepth]uint64 {
+	h := maphash.String(s.seed, k)
+	var idx [sketchDepth]uint64
+	for i := range idx {
+		x := h + uint64(i+1)*0x9e3779b97f4a7c15
+		x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+		x = (x ^ x>>27) * 0x94d049bb133111eb
+		idx[i] = (x ^ x>>31) & s.mask
+	}
+	return idx
+}
+
+// increment records an access to k.
+func (s *cmSketch) increment(k string) {
+	idx := s.indexes(k)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, j := range idx {
+		if s.rows[i][j] < 255 {
+			s.rows[i][j]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.resetAt {
+		s.age()
+	}
+}
+
+// estimate returns the approximate access count of k.
+func (s *cmSketch) estimate(k string) uint8 {
+	idx := s.indexes(k)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	min := uint8(255)
+	for i, j := range idx {
+		if s.rows[i][j] < min {
+			min = s.rows[i][j]
+		}
+	}
+	return min
+}
+
+// age halves all counters.
+func (s *cmSketch) age() {
+	for _, row := range s.rows {
+		for j := range row {
+			row[j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
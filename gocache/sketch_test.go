@@ -0,0 +1,34 @@
+package gocache
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestCMSketch(t *testing.T) {
+	s := newCMSketch(100)
+	for i := 0; i < 10; i++ {
+		s.increment("hot")
+	}
+	s.increment("cold")
+	if n := s.estimate("hot"); n < 10 {
+		t.Error("Expected hot to be estimated at least 10, got", n)
+	}
+	if n := s.estimate("cold"); n < 1 || n >= 10 {
+		t.Error("Unexpected estimate of cold:", n)
+	}
+	if n := s.estimate("missing"); n > 1 {
+		t.Error("Unexpected estimate of a key never seen:", n)
+	}
+	hot := s.estimate("hot")
+	s.age()
+	if n := s.estimate("hot"); n != hot/2 {
+		t.Error("Expected aging to halve hot, got", n)
+	}
+	for i := 0; i < s.resetAt; i++ {
+		s.increment(strconv.Itoa(i))
+	}
+	if s.additions >= s.resetAt {
+		t.Error("Expected the sketch to age itself, got", s.additions, "additions")
+	}
+}
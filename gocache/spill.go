@@ -0,0 +1,98 @@
+package gocache
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+// spilled is the in-memory placeholder of a value written to the spill directory.
+type spilled struct {
+	path string
+}
+
+// WithSpill writes []byte values larger than threshold bytes to files in dir instead of keeping them in memory.
+// Every reader, including the eviction callbacks, the expired channel, Save, Export and SaveDelta, transparently
+// reads them back, and the files are removed when their items are deleted, overwritten, evicted or cleared.
+// Values that fail to be written are kept in memory, and items whose file can't be read are treated as missing.
+// Get then takes the read lock even with WithCopyOnWrite, since a file may be removed once the lock is released.
+// Set writes the file before taking the write lock, and files are removed after it's released.
+func WithSpill(dir string, threshold int) Option {
+	return func(c *Cache) {
+		c.spillDir = dir
+		c.spillThreshold = threshold
+	}
+}
+
+// spill writes v to the spill directory if it's large enough, and returns its placeholder.
+func (c *Cache) spill(v interface{}) interface{} {
+	b, ok := v.([]byte)
+	if c.spillDir == "" || !ok || len(b) <= c.spillThreshold {
+		return v
+	}
+	f, err := ioutil.TempFile(c.spillDir, "gocache-")
+	if err != nil {
+		return v
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return v
+	}
+	return &spilled{path: f.Name()}
+}
+
+// prespill writes v to the spill directory if it's large enough, so Set does it before taking the write lock,
+// and returns its placeholder or nil.
+func (c *Cache) prespill(v interface{}) *spilled {
+	s, _ := c.spill(v).(*spilled)
+	return s
+}
+
+// unspill reads back a spilled value, any other value is returned as is.
+// It must be called with the lock held, or by unlock before it removes the dropped files,
+// so the file can't be removed concurrently.
+func unspill(v interface{}) (interface{}, bool) {
+	s, ok := v.(*spilled)
+	if !ok {
+		return v, true
+	}
+	b, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+// dropSpilled queues the file of a spilled value for removal by unlock, unless it's still used by the replacing value.
+// It must be called with the write lock held.
+func (c *Cache) dropSpilled(old, replacing interface{}) {
+	if s, ok := old.(*spilled); ok && replacing != interface{}(s) {
+		c.spillDrops = append(c.spillDrops, s.path)
+	}
+}
+
+// removeSpilled removes the files of dropped values, it's called without holding the lock.
+func removeSpilled(paths []string) {
+	for _, path := range paths {
+		os.Remove(path)
+	}
+}
+
+// unspilledItems returns the items with their spilled values read back, dropping those that can't be read,
+// or the items themselves if spilling is disabled. It must be called with the lock held.
+func (c *Cache) unspilledItems() map[string]Item {
+	if c.spillDir == "" {
+		return c.items
+	}
+	items := make(map[string]Item, len(c.items))
+	for k, v := range c.items {
+		if obj, ok := unspill(v.Object); ok {
+			v.Object = obj
+			items[k] = v
+		}
+	}
+	return items
+}
@@ -0,0 +1,206 @@
+package gocache
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocache-spill")
+	if err != nil {
+		t.Fatal("Couldn't create spill directory:", err)
+	}
+	defer os.RemoveAll(dir)
+	files := func() int {
+		fs, _ := ioutil.ReadDir(dir)
+		return len(fs)
+	}
+
+	tc := NewCache(DefaultExpiration, time.Hour, WithSpill(dir, 4))
+	defer tc.StopGc()
+	var evicted interface{}
+	tc.OnEvicted(func(k string, v interface{}) {
+		evicted = v
+	})
+	big := []byte("large value")
+	tc.Set("small", []byte("tiny"), DefaultExpiration)
+	tc.Set("big", big, DefaultExpiration)
+	if n := files(); n != 1 {
+		t.Fatal("Expected one spilled file, got", n)
+	}
+	if v, found := tc.Get("big"); !found || !bytes.Equal(v.([]byte), big) {
+		t.Error("Expected the spilled value to be read back, got", v)
+	}
+	if item, found := tc.GetItem("big"); !found || !bytes.Equal(item.Object.([]byte), big) {
+		t.Error("Expected GetItem to read the spilled value back, got", item.Object)
+	}
+
+	tc.Set("big", []byte("another large value"), DefaultExpiration)
+	if n := files(); n != 1 {
+		t.Error("Expected the overwritten file to be removed, got", n)
+	}
+	tc.SetKeepTTL("big", []byte("yet another large value"))
+	if n := files(); n != 1 {
+		t.Error("Expected the file to be replaced, got", n)
+	}
+	tc.Delete("big")
+	if n := files(); n != 0 {
+		t.Error("Expected the deleted file to be removed, got", n)
+	}
+	if !bytes.Equal(evicted.([]byte), []byte("yet another large value")) {
+		t.Error("Expected OnEvicted to get the spilled value, got", evicted)
+	}
+
+	tc.Set("a", big, DefaultExpiration)
+	tc.Set("b", big, DefaultExpiration)
+	tc.ReplaceAll(map[string]interface{}{"a": big}, DefaultExpiration)
+	if n := files(); n != 1 {
+		t.Error("Expected ReplaceAll to replace the files, got", n)
+	}
+	tc.Clear()
+	if n := files(); n != 0 {
+		t.Error("Expected Clear to remove the files, got", n)
+	}
+}
+
+func TestSpillReaders(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocache-spill")
+	if err != nil {
+		t.Fatal("Couldn't create spill directory:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	big := []byte("large value")
+	isBig := func(v interface{}) bool {
+		b, ok := v.([]byte)
+		return ok && bytes.Equal(b, big)
+	}
+	ch := make(chan KeyItem, 1)
+	tc := NewCache(DefaultExpiration, time.Hour, WithSpill(dir, 4), WithCopyOnWrite(), WithDeltaTracking(), WithExpiredChannel(ch))
+	defer tc.StopGc()
+	tc.Set("big", big, DefaultExpiration)
+	if v, found := tc.Get("big"); !found || !isBig(v) {
+		t.Error("Expected Get to read the spilled value back with WithCopyOnWrite, got", v)
+	}
+	if v, _, found := tc.GetStale("big"); !found || !isBig(v) {
+		t.Error("Expected GetStale to read the spilled value back, got", v)
+	}
+	if v, _, found := tc.GetWithVersion("big"); !found || !isBig(v) {
+		t.Error("Expected GetWithVersion to read the spilled value back, got", v)
+	}
+	if v, found := tc.GetAndExtendIfBelow("big", 0, time.Hour); !found || !isBig(v) {
+		t.Error("Expected GetAndExtendIfBelow to read the spilled value back, got", v)
+	}
+	if items := tc.GetN(1); !isBig(items["big"]) {
+		t.Error("Expected GetN to read the spilled value back, got", items)
+	}
+	if items := tc.Sample(1); !isBig(items["big"]) {
+		t.Error("Expected Sample to read the spilled value back, got", items)
+	}
+	if items := tc.GetByPrefix("b"); !isBig(items["big"]) {
+		t.Error("Expected GetByPrefix to read the spilled value back, got", items)
+	}
+	if found, _ := tc.GetManySplit([]string{"big"}); !isBig(found["big"]) {
+		t.Error("Expected GetManySplit to read the spilled value back, got", found)
+	}
+	if items := tc.ItemsByExpiration(); len(items) != 1 || !isBig(items[0].Item.Object) {
+		t.Error("Expected ItemsByExpiration to read the spilled value back, got", items)
+	}
+	if s := tc.Dump(); !strings.Contains(s, "[108 97") {
+		t.Error("Expected Dump to print the spilled value, got", s)
+	}
+
+	var b bytes.Buffer
+	if err := tc.Save(&b); err != nil {
+		t.Error("Couldn't save a spilled value:", err)
+	}
+	other := NewCache(DefaultExpiration, time.Hour)
+	defer other.StopGc()
+	if err := other.Load(&b); err != nil {
+		t.Error("Couldn't load a spilled value:", err)
+	} else if v, _ := other.Get("big"); !isBig(v) {
+		t.Error("Expected Save to write the spilled value, got", v)
+	}
+	b.Reset()
+	if err := tc.Export(&b); err != nil {
+		t.Error("Couldn't export a spilled value:", err)
+	}
+	other = NewCache(DefaultExpiration, time.Hour)
+	defer other.StopGc()
+	if err := other.Import(&b); err != nil {
+		t.Error("Couldn't import a spilled value:", err)
+	} else if v, _ := other.Get("big"); !isBig(v) {
+		t.Error("Expected Export to write the spilled value, got", v)
+	}
+	b.Reset()
+	if err := tc.SaveDelta(&b); err != nil {
+		t.Error("Couldn't save a delta with a spilled value:", err)
+	}
+	other = NewCache(DefaultExpiration, time.Hour)
+	defer other.StopGc()
+	if err := other.ApplyDelta(&b); err != nil {
+		t.Error("Couldn't apply a delta with a spilled value:", err)
+	} else if v, _ := other.Get("big"); !isBig(v) {
+		t.Error("Expected SaveDelta to write the spilled value, got", v)
+	}
+
+	if !tc.CompareAndSwap("big", big, append([]byte("another "), big...)) {
+		t.Error("Expected CompareAndSwap to compare the spilled value")
+	}
+	tc.Set("big", big, time.Nanosecond)
+	<-time.After(time.Millisecond)
+	tc.DeleteExpired()
+	if ki := <-ch; !isBig(ki.Item.Object) {
+		t.Error("Expected the expired channel to get the spilled value, got", ki.Item.Object)
+	}
+	tc.Set("big", big, time.Hour)
+	if k, v, ok := tc.PopNearestExpiry(); !ok || k != "big" || !isBig(v) {
+		t.Error("Expected PopNearestExpiry to read the spilled value back, got", k, v)
+	}
+}
+
+func TestSpillOutsideLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocache-spill")
+	if err != nil {
+		t.Fatal("Couldn't create spill directory:", err)
+	}
+	defer os.RemoveAll(dir)
+	files := func() int {
+		fs, _ := ioutil.ReadDir(dir)
+		return len(fs)
+	}
+
+	big := []byte("large value")
+	tc := NewCache(DefaultExpiration, time.Hour, WithSpill(dir, 4), WithMaxKeyLength(8))
+	defer tc.StopGc()
+	tc.Set("rejected key", big, DefaultExpiration)
+	if n := files(); n != 0 {
+		t.Error("Expected the file of a rejected value to be removed, got", n)
+	}
+
+	events, cancel := tc.Subscribe(1)
+	defer cancel()
+	var evicted interface{}
+	tc.OnEvicted(func(k string, v interface{}) {
+		evicted = v
+		if n := files(); n != 1 {
+			t.Error("Expected the file to be kept until the callback returns, got", n)
+		}
+	})
+	tc.Set("big", big, DefaultExpiration)
+	<-events
+	tc.Delete("big")
+	if e := <-events; e.Op != EventDelete || !bytes.Equal(e.Value.([]byte), big) {
+		t.Error("Expected the delete event to carry the spilled value, got", e)
+	}
+	if !bytes.Equal(evicted.([]byte), big) {
+		t.Error("Expected OnEvicted to get the spilled value, got", evicted)
+	}
+	if n := files(); n != 0 {
+		t.Error("Expected the deleted file to be removed, got", n)
+	}
+}
@@ -0,0 +1,56 @@
+package gocache
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+)
+
+// Export streams the items to w one at a time with gob, without building a snapshot of the cache.
+// It holds the read lock while writing, so writers wait for it to finish.
+func (c *Cache) Export(w io.Writer) error {
+	enc := gob.NewEncoder(w)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for k, v := range c.items {
+		var ok bool
+		if v.Object, ok = unspill(v.Object); !ok {
+			continue
+		}
+		if !c.gobRegistered {
+			if err := register(v.Object); err != nil {
+				return fmt.Errorf("Error registering item %s with Gob library: %v", k, err)
+			}
+		}
+		if err := enc.Encode(&KeyItem{Key: k, Item: v}); err != nil {
+			return fmt.Errorf("Error encoding item %s: %v", k, err)
+		}
+	}
+	return nil
+}
+
+// Import reads items streamed by Export and merges them into the cache one at a time, like Load.
+// Items imported before an error is met are kept.
+func (c *Cache) Import(r io.Reader) error {
+	dec := gob.NewDecoder(r)
+	for {
+		var ki KeyItem
+		if err := dec.Decode(&ki); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if ki.Item.Expiration < 0 {
+			return fmt.Errorf("Item %s has invalid expiration %d", ki.Key, ki.Item.Expiration)
+		}
+		c.mu.Lock()
+		err := c.writable()
+		if err == nil {
+			c.load(ki.Key, ki.Item)
+		}
+		c.unlock()
+		if err != nil {
+			return err
+		}
+	}
+}
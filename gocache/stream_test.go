@@ -0,0 +1,35 @@
+package gocache
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestExportImport(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	for i := 0; i < 100; i++ {
+		tc.Set(string(rune('a'+i%26))+string(rune('a'+i/26)), i, DefaultExpiration)
+	}
+	tc.Set("s", "s", time.Hour)
+	var buf bytes.Buffer
+	if err := tc.Export(&buf); err != nil {
+		t.Fatal("Couldn't export cache:", err)
+	}
+	oc := NewCache(DefaultExpiration, time.Hour)
+	defer oc.StopGc()
+	oc.Set("s", "kept", DefaultExpiration)
+	if err := oc.Import(&buf); err != nil {
+		t.Fatal("Couldn't import cache:", err)
+	}
+	if oc.Count() != tc.Count() {
+		t.Error("Expected", tc.Count(), "items to be imported, got", oc.Count())
+	}
+	if x, _ := oc.Get("aa"); x != 0 {
+		t.Error("aa didn't round-trip:", x)
+	}
+	if x, _ := oc.Get("s"); x != "kept" {
+		t.Error("Import overwrote a live item:", x)
+	}
+}
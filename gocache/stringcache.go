@@ -0,0 +1,95 @@
+package gocache
+
+import (
+	"sync"
+	"time"
+)
+
+// stringItem is a StringCache item, storing its value unboxed.
+type stringItem struct {
+	value      string
+	expiration int64
+}
+
+// StringCache is a cache specialized for string values, which avoids boxing them in interfaces on the hot path.
+// It has the expiration semantics of Cache and runs the same GC loop, without its options.
+type StringCache struct {
+	mu                sync.RWMutex
+	items             map[string]stringItem
+	defaultExpiration time.Duration
+	stopGc            chan struct{}
+	stopOnce          sync.Once
+}
+
+// NewStringCache creates a new string cache and starts its GC loop, which runs every gcInterval if it's positive.
+func NewStringCache(defaultExpiration, gcInterval time.Duration) *StringCache {
+	c := &StringCache{
+		items:             map[string]stringItem{},
+		defaultExpiration: defaultExpiration,
+		stopGc:            make(chan struct{}),
+	}
+	interval := func() time.Duration {
+		return gcInterval
+	}
+	go runGCLoop(interval, c.DeleteExpired, nil, nil, c.stopGc)
+	return c
+}
+
+// Set adds a string to the cache, replacing any existing item.
+// Use DefaultExpiration for the cache's default expiration and NoExpiration for none.
+func (c *StringCache) Set(k, v string, d time.Duration) {
+	if d == DefaultExpiration {
+		d = c.defaultExpiration
+	}
+	var e int64
+	if d > 0 {
+		e = time.Now().Add(d).UnixNano()
+	}
+	c.mu.Lock()
+	c.items[k] = stringItem{value: v, expiration: e}
+	c.mu.Unlock()
+}
+
+// Get returns the string and true if the key exists and hasn't expired.
+func (c *StringCache) Get(k string) (string, bool) {
+	c.mu.RLock()
+	item, found := c.items[k]
+	c.mu.RUnlock()
+	if !found || item.expiration > 0 && time.Now().UnixNano() > item.expiration {
+		return "", false
+	}
+	return item.value, true
+}
+
+// Delete deletes the key from the cache.
+func (c *StringCache) Delete(k string) {
+	c.mu.Lock()
+	delete(c.items, k)
+	c.mu.Unlock()
+}
+
+// Count returns the number of items, including the expired ones not collected yet.
+func (c *StringCache) Count() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.items)
+}
+
+// DeleteExpired deletes all the expired items.
+func (c *StringCache) DeleteExpired() {
+	now := time.Now().UnixNano()
+	c.mu.Lock()
+	for k, item := range c.items {
+		if item.expiration > 0 && now > item.expiration {
+			delete(c.items, k)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// StopGc stops the GC loop.
+func (c *StringCache) StopGc() {
+	c.stopOnce.Do(func() {
+		close(c.stopGc)
+	})
+}
@@ -0,0 +1,78 @@
+package gocache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestStringCache(t *testing.T) {
+	tc := NewStringCache(time.Hour, time.Hour)
+	defer tc.StopGc()
+	tc.Set("a", "1", DefaultExpiration)
+	tc.Set("b", "2", NoExpiration)
+	tc.Set("c", "3", time.Nanosecond)
+	<-time.After(time.Millisecond)
+	if v, found := tc.Get("a"); !found || v != "1" {
+		t.Error("Expected a, got", v, found)
+	}
+	if v, found := tc.Get("b"); !found || v != "2" {
+		t.Error("Expected b, got", v, found)
+	}
+	if _, found := tc.Get("c"); found {
+		t.Error("Expected c to have expired")
+	}
+	tc.DeleteExpired()
+	tc.Delete("a")
+	if n := tc.Count(); n != 1 {
+		t.Error("Expected one item left, got", n)
+	}
+}
+
+func TestStringCacheGCInterval(t *testing.T) {
+	tc := NewStringCache(DefaultExpiration, 0)
+	defer tc.StopGc()
+	tc.Set("a", "1", time.Nanosecond)
+	tc.StopGc()
+
+	tc = NewStringCache(DefaultExpiration, time.Millisecond)
+	defer tc.StopGc()
+	tc.Set("a", "1", time.Nanosecond)
+	deadline := time.Now().Add(time.Second)
+	for tc.Count() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the GC loop to delete the expired item")
+		}
+		<-time.After(time.Millisecond)
+	}
+}
+
+var benchmarkKeys = func() []string {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	return keys
+}()
+
+func BenchmarkStringCacheSetGet(b *testing.B) {
+	tc := NewStringCache(time.Hour, time.Hour)
+	defer tc.StopGc()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		k := benchmarkKeys[i%len(benchmarkKeys)]
+		tc.Set(k, k, DefaultExpiration)
+		tc.Get(k)
+	}
+}
+
+func BenchmarkCacheStringSetGet(b *testing.B) {
+	tc := NewCache(time.Hour, time.Hour)
+	defer tc.StopGc()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		k := benchmarkKeys[i%len(benchmarkKeys)]
+		tc.Set(k, k, DefaultExpiration)
+		tc.Get(k)
+	}
+}
@@ -0,0 +1,106 @@
+package gocache
+
+import "time"
+
+// WithTagLimits bounds the tag index used by SetWithTags to maxTags distinct tags
+// and maxKeysPerTag keys per tag, a non-positive limit disabling the bound.
+// The index only holds the live items, deleted and collected items are removed from it.
+func WithTagLimits(maxTags, maxKeysPerTag int) Option {
+	return func(c *Cache) {
+		c.maxTags = maxTags
+		c.maxKeysPerTag = maxKeysPerTag
+	}
+}
+
+// SetWithTags sets an item like Set and tags it, so it can be deleted together with
+// the other items sharing a tag by InvalidateTag.
+// Setting the key again replaces its tags.
+// It returns ErrTagLimit, without setting the item, if the tags would exceed the limits set by WithTagLimits.
+func (c *Cache) SetWithTags(k string, v interface{}, d time.Duration, tags ...string) error {
+	c.mu.Lock()
+	defer c.unlock()
+	if err := c.checkTags(k, tags); err != nil {
+		return err
+	}
+	if err := c.set(k, v, d); err != nil || len(tags) == 0 {
+		return err
+	}
+	if c.tags == nil {
+		c.tags = map[string]map[string]struct{}{}
+		c.keyTags = map[string][]string{}
+	}
+	for _, tag := range tags {
+		keys, found := c.tags[tag]
+		if !found {
+			keys = map[string]struct{}{}
+			c.tags[tag] = keys
+		}
+		if _, found = keys[k]; !found {
+			keys[k] = struct{}{}
+			c.keyTags[k] = append(c.keyTags[k], tag)
+		}
+	}
+	return nil
+}
+
+// checkTags returns ErrTagLimit if tagging k with tags would exceed the tag limits.
+// The tags k already has don't count, since setting k replaces them.
+func (c *Cache) checkTags(k string, tags []string) error {
+	if c.maxTags <= 0 && c.maxKeysPerTag <= 0 {
+		return nil
+	}
+	wanted := make(map[string]struct{}, len(tags))
+	added := 0
+	for _, tag := range tags {
+		if _, found := wanted[tag]; found {
+			continue
+		}
+		wanted[tag] = struct{}{}
+		keys, found := c.tags[tag]
+		if !found {
+			added++
+			continue
+		}
+		// k itself is already counted in keys if it has the tag
+		if _, tagged := keys[k]; !tagged && c.maxKeysPerTag > 0 && len(keys) >= c.maxKeysPerTag {
+			return ErrTagLimit
+		}
+	}
+	removed := 0
+	for _, tag := range c.keyTags[k] {
+		if _, found := wanted[tag]; !found && len(c.tags[tag]) == 1 {
+			removed++
+		}
+	}
+	if c.maxTags > 0 && len(c.tags)+added-removed > c.maxTags {
+		return ErrTagLimit
+	}
+	return nil
+}
+
+// InvalidateTag deletes all items tagged with tag and returns how many were deleted.
+func (c *Cache) InvalidateTag(tag string) int {
+	c.mu.Lock()
+	defer c.unlock()
+	if c.writable() != nil {
+		return 0
+	}
+	keys := c.tags[tag]
+	n := len(keys)
+	for k := range keys {
+		c.del(k, EvictDeleted)
+	}
+	return n
+}
+
+// untag removes k from the tag index.
+func (c *Cache) untag(k string) {
+	for _, tag := range c.keyTags[k] {
+		keys := c.tags[tag]
+		delete(keys, k)
+		if len(keys) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+	delete(c.keyTags, k)
+}
@@ -0,0 +1,89 @@
+package gocache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTags(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	tc.SetWithTags("a", 1, DefaultExpiration, "product:42", "list")
+	tc.SetWithTags("b", 2, DefaultExpiration, "product:42")
+	tc.SetWithTags("c", 3, DefaultExpiration, "list")
+	tc.SetWithTags("d", 4, time.Millisecond, "product:42")
+	tc.Delete("b")
+	<-time.After(5 * time.Millisecond)
+	tc.DeleteExpired()
+
+	if n := tc.InvalidateTag("product:42"); n != 1 {
+		t.Error("Expected 1 item to be invalidated, got", n)
+	}
+	if _, found := tc.Get("a"); found {
+		t.Error("Found a after its tag was invalidated")
+	}
+	if _, found := tc.Get("c"); !found {
+		t.Error("c was deleted although it isn't tagged with product:42")
+	}
+	if _, found := tc.keyTags["a"]; found {
+		t.Error("a is still in the tag index")
+	}
+
+	tc.Set("c", 5, DefaultExpiration)
+	if n := tc.InvalidateTag("list"); n != 0 {
+		t.Error("Expected re-setting c to drop its tags, invalidated", n)
+	}
+	if len(tc.tags) != 0 || len(tc.keyTags) != 0 {
+		t.Error("The tag index wasn't cleaned up:", tc.tags, tc.keyTags)
+	}
+}
+
+func TestTagLimits(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour, WithTagLimits(2, 2))
+	defer tc.StopGc()
+	if err := tc.SetWithTags("a", 1, DefaultExpiration, "x", "y"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if err := tc.SetWithTags("b", 2, DefaultExpiration, "z"); err != ErrTagLimit {
+		t.Error("Expected too many tags to fail, got", err)
+	}
+	if _, found := tc.Get("b"); found {
+		t.Error("Expected the rejected item not to be set")
+	}
+	tc.SetWithTags("b", 2, DefaultExpiration, "x")
+	if err := tc.SetWithTags("c", 3, DefaultExpiration, "x"); err != ErrTagLimit {
+		t.Error("Expected too many keys per tag to fail, got", err)
+	}
+	if err := tc.SetWithTags("b", 3, DefaultExpiration, "x"); err != nil {
+		t.Error("Expected retagging a key not to count twice, got", err)
+	}
+
+	tc = NewCache(DefaultExpiration, time.Hour, WithTagLimits(1, 0))
+	defer tc.StopGc()
+	tc.SetWithTags("k", 1, DefaultExpiration, "a")
+	if err := tc.SetWithTags("k", 2, DefaultExpiration, "b"); err != nil {
+		t.Error("Expected replacing the only tag of a key to fit, got", err)
+	}
+	if err := tc.SetWithTags("other", 2, DefaultExpiration, "a"); err != ErrTagLimit {
+		t.Error("Expected a second distinct tag to fail, got", err)
+	}
+	if n := tc.InvalidateTag("b"); n != 1 {
+		t.Error("Expected k to be tagged with b, got", n)
+	}
+}
+
+func TestTagIndexCleanedOnExpiry(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour, WithTagLimits(1, 0))
+	defer tc.StopGc()
+	for i := 0; i < 100; i++ {
+		tag := "tag" + string(rune('a'+i%26))
+		if err := tc.SetWithTags("a", i, time.Nanosecond, tag); err != nil {
+			t.Fatal("Expected the tags of collected items to be freed, got", err)
+		}
+		<-time.After(time.Microsecond)
+		tc.DeleteExpired()
+		if len(tc.tags) != 0 || len(tc.keyTags) != 0 {
+			t.Fatal("Expected expiry to clean the tag index:", tc.tags, tc.keyTags)
+		}
+	}
+}
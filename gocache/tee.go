@@ -0,0 +1,120 @@
+package gocache
+
+import "time"
+
+// TeeMode decides how WithTee mirrors writes to the other cache.
+type TeeMode int
+
+const (
+	// TeeSync mirrors a write before the writer returns.
+	TeeSync TeeMode = iota
+	// TeeAsync mirrors a write in its own goroutine, so there is no ordering guarantee between mirrored writes.
+	TeeAsync
+)
+
+type tee struct {
+	other    *Cache
+	mode     TeeMode
+	fallback bool
+}
+
+// WithTee mirrors successful Set and Delete calls to other, e.g. a larger second-tier cache.
+// Durations are passed through as is, so DefaultExpiration means the default expiration of other.
+// Other writers aren't mirrored.
+func WithTee(other *Cache, mode TeeMode) Option {
+	return func(c *Cache) {
+		if c.tee == nil {
+			c.tee = &tee{}
+		}
+		c.tee.other = other
+		c.tee.mode = mode
+	}
+}
+
+// WithTeeFallback makes Get look up the cache set by WithTee on a miss,
+// promoting a found item into this cache with its remaining expiration.
+func WithTeeFallback() Option {
+	return func(c *Cache) {
+		if c.tee == nil {
+			c.tee = &tee{}
+		}
+		c.tee.fallback = true
+	}
+}
+
+// WithFallbacks makes Get look up the given caches in order on a miss, after the WithTeeFallback cache if any,
+// and promote the first item found into this cache. Promoted items expire after ttl,
+// or keep their remaining expiration with DefaultExpiration.
+// Only the fallback caches themselves are looked up, not their own fallbacks.
+func WithFallbacks(ttl time.Duration, caches ...*Cache) Option {
+	return func(c *Cache) {
+		c.fallbacks = caches
+		c.fallbackTTL = ttl
+	}
+}
+
+// mirror applies f to the tee cache, if any, according to its mode.
+func (c *Cache) mirror(f func(other *Cache)) {
+	if c.tee == nil || c.tee.other == nil {
+		return
+	}
+	if c.tee.mode == TeeAsync {
+		go f(c.tee.other)
+		return
+	}
+	f(c.tee.other)
+}
+
+// getFallback looks up the key k in the tee cache and the fallback caches and promotes the first item found, if any.
+func (c *Cache) getFallback(k string) (interface{}, bool) {
+	layers := c.fallbacks
+	if c.tee != nil && c.tee.fallback && c.tee.other != nil {
+		layers = append([]*Cache{c.tee.other}, layers...)
+	}
+	for _, other := range layers {
+		if item, found := other.GetItem(k); found {
+			c.promote(k, item)
+			return item.Object, true
+		}
+	}
+	return nil, false
+}
+
+// promote stores an item found in a lower layer unless a live item with the same key exists.
+func (c *Cache) promote(k string, item Item) {
+	switch {
+	case c.fallbackTTL > 0:
+		item.Expiration = c.deadline(c.fallbackTTL)
+	case c.fallbackTTL < 0:
+		item.Expiration = 0
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	if c.writable() == nil {
+		c.load(k, item)
+	}
+}
+
+// DemoteExpiringSoon moves the live items expiring within the given duration to other, where they expire after newTTL,
+// and returns how many were moved. They are deleted from this cache, firing its eviction callbacks
+// with EvictDeleted, before being set in other, so they briefly are in neither.
+func (c *Cache) DemoteExpiringSoon(other *Cache, within, newTTL time.Duration) int {
+	var demoted []KeyItem
+	c.mu.Lock()
+	if c.writable() == nil {
+		for k, v := range c.items {
+			if v.Expiration > 0 && !c.expired(v) && c.ttl(v) < within {
+				v.Object, _ = unspill(v.Object)
+				demoted = append(demoted, KeyItem{Key: k, Item: v})
+			}
+		}
+		for _, ki := range demoted {
+			c.del(ki.Key, EvictDeleted)
+		}
+	}
+	c.unlock()
+	for _, ki := range demoted {
+		other.Set(ki.Key, ki.Item.Object, newTTL)
+	}
+	return len(demoted)
+}
@@ -0,0 +1,123 @@
+package gocache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTee(t *testing.T) {
+	l2 := NewCache(DefaultExpiration, time.Hour)
+	defer l2.StopGc()
+	l1 := NewCache(DefaultExpiration, time.Hour, WithTee(l2, TeeSync))
+	defer l1.StopGc()
+
+	l1.Set("a", 1, time.Hour)
+	if v, found := l2.Get("a"); !found || v.(int) != 1 {
+		t.Error("Expected Set to be mirrored, got", v)
+	}
+	l1.Delete("a")
+	if _, found := l2.Get("a"); found {
+		t.Error("Expected Delete to be mirrored")
+	}
+
+	l2.Set("b", 2, DefaultExpiration)
+	if _, found := l1.Get("b"); found {
+		t.Error("Expected no fallback without WithTeeFallback")
+	}
+}
+
+func TestTeeAsync(t *testing.T) {
+	l2 := NewCache(DefaultExpiration, time.Hour)
+	defer l2.StopGc()
+	l1 := NewCache(DefaultExpiration, time.Hour, WithTee(l2, TeeAsync))
+	defer l1.StopGc()
+
+	l1.Set("a", 1, DefaultExpiration)
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, found := l2.Get("a"); found {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected Set to be mirrored asynchronously")
+		}
+		<-time.After(time.Millisecond)
+	}
+}
+
+func TestTeeFallback(t *testing.T) {
+	l2 := NewCache(DefaultExpiration, time.Hour)
+	defer l2.StopGc()
+	l1 := NewCache(DefaultExpiration, time.Hour, WithTee(l2, TeeSync), WithTeeFallback())
+	defer l1.StopGc()
+
+	l2.Set("a", 1, time.Hour)
+	v, found := l1.Get("a")
+	if !found || v.(int) != 1 {
+		t.Error("Expected Get to fall back to the tee cache, got", v)
+	}
+	item, found := l1.GetItem("a")
+	if !found {
+		t.Fatal("Expected the item to be promoted")
+	}
+	if want, _ := l2.GetItem("a"); item.Expiration != want.Expiration {
+		t.Error("Expected the promoted item to keep its expiration")
+	}
+	if _, found := l1.Get("missing"); found {
+		t.Error("Expected a miss in both caches to be a miss")
+	}
+}
+
+func TestFallbacks(t *testing.T) {
+	l3 := NewCache(DefaultExpiration, time.Hour)
+	defer l3.StopGc()
+	l2 := NewCache(DefaultExpiration, time.Hour)
+	defer l2.StopGc()
+	l1 := NewCache(DefaultExpiration, time.Hour, WithFallbacks(time.Minute, l2, l3))
+	defer l1.StopGc()
+
+	l3.Set("a", 3, NoExpiration)
+	l2.Set("b", 2, NoExpiration)
+	l3.Set("b", 3, NoExpiration)
+	if v, found := l1.Get("a"); !found || v.(int) != 3 {
+		t.Error("Expected a to be found in the third layer, got", v)
+	}
+	if v, found := l1.Get("b"); !found || v.(int) != 2 {
+		t.Error("Expected b to be found in the second layer first, got", v)
+	}
+	item, found := l1.GetItem("a")
+	if !found {
+		t.Fatal("Expected a to be promoted")
+	}
+	if d := time.Until(time.Unix(0, item.Expiration)); d <= 0 || d > time.Minute {
+		t.Error("Expected the promoted item to expire after the fallback TTL, got", d)
+	}
+	if _, found := l2.GetItem("a"); found {
+		t.Error("Expected intermediate layers not to be filled")
+	}
+}
+
+func TestDemoteExpiringSoon(t *testing.T) {
+	hot := NewCache(DefaultExpiration, time.Hour)
+	defer hot.StopGc()
+	warm := NewCache(DefaultExpiration, time.Hour)
+	defer warm.StopGc()
+	hot.Set("soon", 1, time.Second)
+	hot.Set("later", 2, time.Hour)
+	hot.Set("forever", 3, NoExpiration)
+	if n := hot.DemoteExpiringSoon(warm, time.Minute, time.Hour); n != 1 {
+		t.Error("Expected 1 item to be demoted, got", n)
+	}
+	if _, found := hot.Get("soon"); found {
+		t.Error("Expected the demoted item to be deleted")
+	}
+	if v, found := warm.Get("soon"); !found || v != 1 {
+		t.Error("Expected the demoted item in the other cache, got", v)
+	}
+	if item, _ := warm.GetItem("soon"); time.Until(time.Unix(0, item.Expiration)) < 59*time.Minute {
+		t.Error("Expected the demoted item to get the new TTL")
+	}
+	if hot.Count() != 2 || warm.Count() != 1 {
+		t.Error("Expected the other items to stay, got", hot.Count(), warm.Count())
+	}
+}
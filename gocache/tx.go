@@ -0,0 +1,225 @@
+package gocache
+
+import "time"
+
+// Tx is a transaction run by Transact. Its writes are staged and only applied to the cache
+// once the transaction function returns, unless it calls Rollback.
+type Tx struct {
+	c          *Cache
+	items      map[string]Item     // the snapshot the transaction reads
+	reads      map[string]uint64   // versions of the keys read, 0 for missing ones
+	ranged     bool                // whether Range read every item
+	writes     map[string]*txWrite // nil for deleted keys
+	rolledBack bool
+}
+
+// txWrite is a Set staged by a transaction.
+type txWrite struct {
+	v interface{}
+	d time.Duration
+}
+
+// Transact runs f against a snapshot of the cache taken with the read lock held, so it sees a consistent view,
+// and then applies the writes it staged with tx.Set and tx.Delete all at once with the write lock held,
+// unless it called tx.Rollback. f is called without holding the lock, like other callbacks,
+// and must only access the cache through tx. If the items it read changed before its writes could be applied,
+// f runs again against a fresh snapshot, so it must not have other side effects.
+// The writes are all applied or none is: Transact returns ErrKeyTooLong or ErrValueTooLarge if one is rejected,
+// and ErrCapacityExceeded if they set more keys than WithMaxItems allows. The capacity is otherwise made
+// by evicting items the transaction doesn't set. It returns ErrClosed or ErrFrozen without running f
+// if the cache doesn't accept writes.
+func (c *Cache) Transact(f func(tx *Tx)) error {
+	for {
+		c.mu.RLock()
+		if err := c.writable(); err != nil {
+			c.mu.RUnlock()
+			return err
+		}
+		tx := &Tx{c: c, items: c.snapshotItems(), reads: map[string]uint64{}, writes: map[string]*txWrite{}}
+		c.mu.RUnlock()
+		f(tx)
+		if tx.rolledBack {
+			return nil
+		}
+		c.mu.Lock()
+		if tx.conflicts() {
+			c.unlock()
+			continue
+		}
+		err := tx.commit()
+		c.unlock()
+		return err
+	}
+}
+
+// snapshotItems returns the items as of now, it must be called with the lock held.
+// It shares the WithCopyOnWrite snapshot, which is up to date then, instead of copying the items.
+func (c *Cache) snapshotItems() map[string]Item {
+	if c.cow {
+		return c.snapshot.Load().(map[string]Item)
+	}
+	items := make(map[string]Item, len(c.items))
+	for k, v := range c.items {
+		items[k] = v
+	}
+	return items
+}
+
+// liveVersion returns the version of item, or 0 if it's missing or expired.
+func (c *Cache) liveVersion(item Item, found bool) uint64 {
+	if !found || c.expired(item) {
+		return 0
+	}
+	return item.Version
+}
+
+// conflicts returns whether an item the transaction read changed since its snapshot,
+// it must be called with the write lock held.
+func (tx *Tx) conflicts() bool {
+	c := tx.c
+	if tx.ranged {
+		for k, item := range c.items {
+			old, found := tx.items[k]
+			if c.liveVersion(item, true) != c.liveVersion(old, found) {
+				return true
+			}
+		}
+		for k, old := range tx.items {
+			item, found := c.items[k]
+			if c.liveVersion(item, found) != c.liveVersion(old, true) {
+				return true
+			}
+		}
+	}
+	for k, version := range tx.reads {
+		item, found := c.items[k]
+		if c.liveVersion(item, found) != version {
+			return true
+		}
+	}
+	return false
+}
+
+// commit validates the staged writes and applies them if they're all accepted,
+// it must be called with the write lock held.
+func (tx *Tx) commit() error {
+	c := tx.c
+	if err := c.writable(); err != nil {
+		return err
+	}
+	sets := 0
+	for k, w := range tx.writes {
+		if w == nil {
+			continue
+		}
+		sets++
+		if err := c.checkKey(k); err != nil {
+			return err
+		}
+		if err := c.checkValue(w.v); err != nil {
+			return err
+		}
+	}
+	if c.maxItems > 0 && sets > c.maxItems {
+		return ErrCapacityExceeded
+	}
+	for k, w := range tx.writes {
+		if w == nil {
+			c.del(k, EvictDeleted)
+		}
+	}
+	if c.maxItems > 0 {
+		if c.reclaimExpired && tx.overCapacity() {
+			c.deleteExpired(time.Time{})
+		}
+		for tx.overCapacity() {
+			c.del(c.victim(tx.writes), EvictCapacity)
+		}
+	}
+	for k, w := range tx.writes {
+		if w != nil {
+			c.set(k, w.v, w.d)
+		}
+	}
+	return nil
+}
+
+// overCapacity returns whether setting the staged keys would exceed WithMaxItems.
+func (tx *Tx) overCapacity() bool {
+	n := len(tx.c.items)
+	for k, w := range tx.writes {
+		if _, found := tx.c.items[k]; w != nil && !found {
+			n++
+		}
+	}
+	return n > tx.c.maxItems
+}
+
+// Get returns the value of key k as seen by the transaction.
+func (tx *Tx) Get(k string) (interface{}, bool) {
+	if w, found := tx.writes[k]; found {
+		if w == nil {
+			return nil, false
+		}
+		return w.v, true
+	}
+	item, found := tx.items[k]
+	tx.reads[k] = tx.c.liveVersion(item, found)
+	return tx.get(k, item, found)
+}
+
+// get returns the value of the snapshot item with key k if it's live.
+// Spilled values are read back with the read lock held, as long as the item hasn't changed since the snapshot,
+// and are treated as missing otherwise since the transaction then conflicts anyway.
+func (tx *Tx) get(k string, item Item, found bool) (interface{}, bool) {
+	if !found || tx.c.expired(item) {
+		return nil, false
+	}
+	if _, ok := item.Object.(*spilled); !ok {
+		return item.Object, true
+	}
+	tx.c.mu.RLock()
+	defer tx.c.mu.RUnlock()
+	if cur, found := tx.c.items[k]; !found || cur.Version != item.Version {
+		return nil, false
+	}
+	return unspill(item.Object)
+}
+
+// Set stages setting key k to v with the expiration d.
+func (tx *Tx) Set(k string, v interface{}, d time.Duration) {
+	tx.writes[k] = &txWrite{v: v, d: d}
+}
+
+// Delete stages deleting key k.
+func (tx *Tx) Delete(k string) {
+	tx.writes[k] = nil
+}
+
+// Range calls f with the live items as seen by the transaction, in no particular order, until f returns false.
+// f may stage writes, which Range doesn't visit.
+func (tx *Tx) Range(f func(k string, v interface{}) bool) {
+	tx.ranged = true
+	staged := make(map[string]*txWrite, len(tx.writes))
+	for k, w := range tx.writes {
+		staged[k] = w
+	}
+	for k, item := range tx.items {
+		if _, found := staged[k]; found {
+			continue
+		}
+		if v, found := tx.get(k, item, true); found && !f(k, v) {
+			return
+		}
+	}
+	for k, w := range staged {
+		if w != nil && !f(k, w.v) {
+			return
+		}
+	}
+}
+
+// Rollback discards the staged writes, Transact then leaves the cache unchanged.
+func (tx *Tx) Rollback() {
+	tx.rolledBack = true
+}
@@ -0,0 +1,128 @@
+package gocache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTransact(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Set("c", 3, time.Nanosecond)
+	<-time.After(time.Millisecond)
+	err := tc.Transact(func(tx *Tx) {
+		seen := map[string]bool{}
+		tx.Range(func(k string, v interface{}) bool {
+			seen[k] = true
+			if v.(int)%2 == 0 {
+				tx.Delete(k)
+			} else {
+				tx.Set(k, v.(int)*10, DefaultExpiration)
+			}
+			return true
+		})
+		if len(seen) != 2 {
+			t.Error("Expected Range to visit the live items, got", seen)
+		}
+		if v, found := tx.Get("a"); !found || v.(int) != 10 {
+			t.Error("Expected the transaction to see its writes, got", v, found)
+		}
+		if _, found := tx.Get("b"); found {
+			t.Error("Expected the transaction to see its deletes")
+		}
+		if v, _ := tc.Get("a"); v.(int) != 1 {
+			t.Error("Expected writes to be staged until the end")
+		}
+	})
+	if err != nil {
+		t.Error("Transact failed:", err)
+	}
+	if v, found := tc.Get("a"); !found || v.(int) != 10 {
+		t.Error("Expected the transaction to be committed, got", v, found)
+	}
+	if _, found := tc.Get("b"); found {
+		t.Error("Expected b to be deleted")
+	}
+
+	tc.Transact(func(tx *Tx) {
+		tx.Set("a", 100, DefaultExpiration)
+		tx.Rollback()
+	})
+	if v, _ := tc.Get("a"); v.(int) != 10 {
+		t.Error("Expected a rolled back transaction to change nothing, got", v)
+	}
+
+	tc = NewCache(DefaultExpiration, time.Hour, WithMaxKeyLength(1))
+	defer tc.StopGc()
+	err = tc.Transact(func(tx *Tx) {
+		tx.Set("a", 1, DefaultExpiration)
+		tx.Set("long", 2, DefaultExpiration)
+	})
+	if err != ErrKeyTooLong || tc.Count() != 0 {
+		t.Error("Expected a long key to fail the whole transaction, got", err, tc.Count())
+	}
+
+	tc = NewCache(DefaultExpiration, time.Hour, WithMaxValueBytes(64))
+	defer tc.StopGc()
+	err = tc.Transact(func(tx *Tx) {
+		tx.Set("small", 1, DefaultExpiration)
+		tx.Set("big", make([]byte, 1024), DefaultExpiration)
+	})
+	if err != ErrValueTooLarge || tc.Count() != 0 {
+		t.Error("Expected a large value to fail the whole transaction, got", err, tc.Count())
+	}
+}
+
+func TestTransactCapacity(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour, WithMaxItems(2))
+	defer tc.StopGc()
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	err := tc.Transact(func(tx *Tx) {
+		tx.Set("a", 10, DefaultExpiration)
+		tx.Set("c", 3, DefaultExpiration)
+	})
+	if err != nil {
+		t.Error("Transact failed:", err)
+	}
+	if v, _ := tc.Get("a"); v != 10 {
+		t.Error("Expected the transaction not to evict a key it sets, got", v)
+	}
+	if _, found := tc.Get("b"); found || tc.Count() != 2 {
+		t.Error("Expected b to be evicted to make room, got", tc.Count())
+	}
+	err = tc.Transact(func(tx *Tx) {
+		tx.Set("x", 1, DefaultExpiration)
+		tx.Set("y", 2, DefaultExpiration)
+		tx.Set("z", 3, DefaultExpiration)
+	})
+	if err != ErrCapacityExceeded {
+		t.Error("Expected ErrCapacityExceeded, got", err)
+	}
+	if v, _ := tc.Get("c"); v != 3 || tc.Count() != 2 {
+		t.Error("Expected a rejected transaction to evict nothing, got", tc.Count())
+	}
+}
+
+func TestTransactConflict(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	tc.Set("a", 1, DefaultExpiration)
+	runs := 0
+	err := tc.Transact(func(tx *Tx) {
+		runs++
+		v, _ := tx.Get("a")
+		if runs == 1 {
+			tc.Set("a", 5, DefaultExpiration)
+		}
+		tx.Set("a", v.(int)+1, DefaultExpiration)
+	})
+	if err != nil {
+		t.Error("Transact failed:", err)
+	}
+	if v, _ := tc.Get("a"); runs != 2 || v != 6 {
+		t.Error("Expected the transaction to run again after a conflicting write, got", runs, v)
+	}
+}
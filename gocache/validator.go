@@ -0,0 +1,77 @@
+package gocache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// validator is the validity predicate of an item set by SetWithValidator.
+type validator struct {
+	f func() bool
+}
+
+// SetWithValidator sets an item like Set that is also treated as expired once valid returns false,
+// e.g. when a version it depends on was bumped elsewhere. Get calls valid on every hit without holding the lock
+// and misses if it returns false or panics, and the GC deletes invalid items with EvictInvalidated.
+// Setting the key again without a validator drops it.
+func (c *Cache) SetWithValidator(k string, v interface{}, d time.Duration, valid func() bool) {
+	c.mu.Lock()
+	defer c.unlock()
+	if c.set(k, v, d) != nil {
+		return
+	}
+	if c.validators == nil {
+		c.validators = map[string]*validator{}
+		atomic.StoreInt32(&c.validated, 1)
+	}
+	c.validators[k] = &validator{f: valid}
+}
+
+// valid returns whether the validator of key k, if any, accepts its item.
+func (c *Cache) valid(k string) bool {
+	c.mu.RLock()
+	v, found := c.validators[k]
+	c.mu.RUnlock()
+	return !found || c.check(v)
+}
+
+// check calls the validator v, a panic meaning the item is invalid.
+func (c *Cache) check(v *validator) bool {
+	valid := false
+	c.safely(func() { valid = v.f() })
+	return valid
+}
+
+// deleteInvalid deletes the items rejected by their validator, which are called without holding the lock.
+func (c *Cache) deleteInvalid() {
+	c.mu.RLock()
+	if len(c.validators) == 0 {
+		c.mu.RUnlock()
+		return
+	}
+	validators := make(map[string]*validator, len(c.validators))
+	for k, v := range c.validators {
+		validators[k] = v
+	}
+	c.mu.RUnlock()
+	var invalid []string
+	for k, v := range validators {
+		if !c.check(v) {
+			invalid = append(invalid, k)
+		}
+	}
+	if len(invalid) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	if c.writable() != nil {
+		return
+	}
+	for _, k := range invalid {
+		// Skip items set again while the validators ran
+		if c.validators[k] == validators[k] {
+			c.del(k, EvictInvalidated)
+		}
+	}
+}
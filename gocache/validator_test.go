@@ -0,0 +1,65 @@
+package gocache
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSetWithValidator(t *testing.T) {
+	var reasons []EvictReason
+	tc := NewCache(DefaultExpiration, time.Hour)
+	defer tc.StopGc()
+	tc.OnEvictedWithReason(func(k string, v interface{}, reason EvictReason) {
+		reasons = append(reasons, reason)
+	})
+	var version int32
+	valid := func() bool {
+		// Calling the cache from the validator must not deadlock
+		tc.Count()
+		return atomic.LoadInt32(&version) == 0
+	}
+	tc.SetWithValidator("a", 1, DefaultExpiration, valid)
+	tc.SetWithValidator("b", 2, time.Nanosecond, valid)
+	tc.SetWithValidator("c", 3, DefaultExpiration, valid)
+	tc.Set("c", 4, DefaultExpiration)
+	<-time.After(time.Millisecond)
+	if v, found := tc.Get("a"); !found || v.(int) != 1 {
+		t.Error("Expected a valid item, got", v, found)
+	}
+	if _, found := tc.Get("b"); found {
+		t.Error("Expected an expired item to be missing even if valid")
+	}
+
+	atomic.StoreInt32(&version, 1)
+	if _, found := tc.Get("a"); found {
+		t.Error("Expected an invalidated item to be missing")
+	}
+	if v, found := tc.Get("c"); !found || v.(int) != 4 {
+		t.Error("Expected Set to drop the validator, got", v, found)
+	}
+	tc.RunGC()
+	if tc.Count() != 1 {
+		t.Error("Expected the GC to delete the invalid items, got", tc.Count())
+	}
+	if len(reasons) != 2 || reasons[0] == reasons[1] {
+		t.Error("Expected an expired and an invalidated eviction, got", reasons)
+	}
+
+	tc.SetWithValidator("d", 5, DefaultExpiration, func() bool { panic("boom") })
+	if _, found := tc.Get("d"); found {
+		t.Error("Expected a panicking validator to invalidate its item")
+	}
+	if tc.LastCallbackError() == nil {
+		t.Error("Expected the validator panic to be recorded")
+	}
+}
+
+func TestSetWithValidatorConcurrentGC(t *testing.T) {
+	tc := NewCache(DefaultExpiration, time.Millisecond)
+	defer tc.StopGc()
+	for i := 0; i < 100; i++ {
+		tc.SetWithValidator("a", i, DefaultExpiration, func() bool { return true })
+		tc.Get("a")
+	}
+}